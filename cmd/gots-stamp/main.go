@@ -6,15 +6,53 @@ import (
 	"os"
 
 	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps/client"
 )
 
-const defaultCalendar = "https://alice.btc.calendar.opentimestamps.org"
+var (
+	flagNetwork = flag.String(
+		"network", "mainnet", "bitcoin network: mainnet, testnet, signet or regtest",
+	)
+	flagCalendar = flag.String(
+		"calendar", "",
+		"calendar URL (default the network's first calendar, required off mainnet)",
+	)
+	flagProxy = flag.String(
+		"socks5-proxy", "", "SOCKS5 proxy for calendars, like 127.0.0.1:9050",
+	)
+	calendarProxies = &opentimestamps.CalendarProxies{}
+)
+
+func init() {
+	flag.Var(
+		calendarProxies, "calendar-proxy",
+		"SOCKS5 proxy of one calendar as URL=PROXY, or URL=none (repeatable)",
+	)
+}
 
 func main() {
 	flag.Parse()
 	path := flag.Arg(0)
 
-	cal, err := opentimestamps.NewRemoteCalendar(defaultCalendar)
+	network, err := client.BitcoinNetworkByName(*flagNetwork)
+	if err != nil {
+		log.Fatal(err)
+	}
+	calendarURL := *flagCalendar
+	if calendarURL == "" {
+		calendarURL, err = network.DefaultCalendar()
+		if err != nil {
+			log.Fatalf("%v, use -calendar", err)
+		}
+	}
+
+	if *flagProxy != "" {
+		calendarProxies.Default, err = opentimestamps.ParseSOCKS5Proxy(*flagProxy)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	cal, err := calendarProxies.NewCalendar(calendarURL)
 	if err != nil {
 		log.Fatalf("error creating remote calendar: %v", err)
 	}
@@ -3,55 +3,125 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
 )
 
+var (
+	flagWorkers = flag.Int(
+		"workers", 16, "total number of concurrent calendar requests",
+	)
+	flagPerCalendar = flag.Int(
+		"per-calendar", 4, "number of concurrent requests to one calendar",
+	)
+	flagProxy = flag.String(
+		"socks5-proxy", "", "SOCKS5 proxy for calendars, like 127.0.0.1:9050",
+	)
+	calendarProxies = &opentimestamps.CalendarProxies{}
+)
+
+func init() {
+	flag.Var(
+		calendarProxies, "calendar-proxy",
+		"SOCKS5 proxy of one calendar as URL=PROXY, or URL=none (repeatable)",
+	)
+}
+
 func main() {
 	flag.Parse()
-	path := flag.Arg(0)
-	dts, err := opentimestamps.NewDetachedTimestampFromPath(path)
-	if err != nil {
-		log.Fatalf(
-			"error reading detached timestamp %s: %v",
-			path, err,
-		)
+	if flag.NArg() == 0 {
+		log.Fatal("no proof files given")
 	}
 
-	var upgraded *opentimestamps.Timestamp
-
-	for n, pts := range opentimestamps.PendingTimestamps(dts.Timestamp) {
-		fmt.Printf(
-			"#%2d: upgrade %v\n     %x\n    ",
-			n, pts.PendingAttestation, pts.Timestamp.Message,
-		)
-		u, err := pts.Upgrade()
+	if *flagProxy != "" {
+		proxy, err := opentimestamps.ParseSOCKS5Proxy(*flagProxy)
 		if err != nil {
-			fmt.Printf(" error %v", err)
-		} else {
-			fmt.Printf(" success")
+			log.Fatal(err)
 		}
-		fmt.Print("\n")
+		calendarProxies.Default = proxy
+	}
 
-		// FIXME merge timestamp instead of replacing it
-		upgraded = u
-		break
+	var paths []string
+	var proofs []*opentimestamps.DetachedTimestamp
+	var timestamps []*opentimestamps.Timestamp
+	for _, path := range flag.Args() {
+		dts, err := opentimestamps.NewDetachedTimestampFromPath(path)
+		if err != nil {
+			log.Fatalf(
+				"error reading detached timestamp %s: %v",
+				path, err,
+			)
+		}
+		paths = append(paths, path)
+		proofs = append(proofs, dts)
+		timestamps = append(timestamps, dts.Timestamp)
 	}
 
-	if upgraded == nil {
-		log.Fatal("no pending timestamps found")
+	results := opentimestamps.UpgradeTimestamps(
+		timestamps, opentimestamps.UpgradeOptions{
+			Workers:        *flagWorkers,
+			MaxPerCalendar: *flagPerCalendar,
+			NewCalendar:    calendarProxies.NewCalendar,
+		},
+	)
+
+	failed := false
+	for i, res := range results {
+		path := paths[i]
+		for _, err := range res.Errors {
+			fmt.Printf("%s: error %v\n", path, err)
+		}
+		if res.Pending == 0 {
+			fmt.Printf("%s: no pending timestamps found\n", path)
+			continue
+		}
+		fmt.Printf(
+			"%s: upgraded %d of %d pending timestamps\n",
+			path, res.Upgraded, res.Pending,
+		)
+		if res.Upgraded == 0 {
+			failed = true
+			continue
+		}
+		if err := writeProof(path, proofs[i]); err != nil {
+			log.Fatalf("error writing detached timestamp %s: %v", path, err)
+		}
+	}
+	if failed {
+		os.Exit(1)
 	}
+}
 
-	dts.Timestamp = upgraded
-	f, err := os.Create(path)
+// writeProof replaces the proof file at path. The proof is written to a
+// temporary file first, so the old one stays intact on errors.
+func writeProof(path string, dts *opentimestamps.DetachedTimestamp) error {
+	data, err := dts.MarshalBinary()
 	if err != nil {
-		log.Fatalf("error opening output file: %v", err)
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".ots")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
 	}
-	defer f.Close()
-	if err := dts.WriteToStream(f); err != nil {
-		log.Fatalf("error writing detached timestamp: %v", err)
+	if err := tmp.Close(); err != nil {
+		return err
 	}
-	log.Print("timestamp updated successfully")
+	return os.Rename(tmp.Name(), path)
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps/client"
+)
+
+// proofPaths expands directories in args to the .ots files below them.
+func proofPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		err = filepath.Walk(arg, func(
+			path string, info os.FileInfo, err error,
+		) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(path, ".ots") {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// describe returns a line about the outcome of a report
+func describe(r *client.Report, status client.ReportStatus) string {
+	switch status {
+	case client.StatusVerified:
+		if interval := r.Interval(); interval != nil {
+			return fmt.Sprintf("verified, existed no later than %v", interval.Latest)
+		}
+		return fmt.Sprintf("verified, attested time %v", r.Time())
+	case client.StatusPending:
+		return "pending"
+	}
+	if err := r.Err(); err != nil {
+		return fmt.Sprintf("failed: %v", err)
+	}
+	return "failed: no verifiable attestations"
+}
+
+// verifyMany verifies all proofs in args concurrently, prints a line for
+// each and a summary. It returns the exit code.
+func verifyMany(verifier *client.MultiVerifier, args []string) int {
+	paths, err := proofPaths(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var policy *client.VerificationPolicy
+	if *flagPolicy != "" {
+		policy, err = client.LoadVerificationPolicy(*flagPolicy)
+		if err != nil {
+			log.Fatalf("error reading policy %s: %v", *flagPolicy, err)
+		}
+	}
+	since, err := pendingSince()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// each proof is read by the worker verifying it, and only the line
+	// about it is kept
+	var summary client.BulkSummary
+	lines := make([]string, len(paths))
+	readErrs := make([]error, len(paths))
+	now := time.Now()
+	client.BulkReportFunc(len(paths), func(i int) *client.Report {
+		dts, err := opentimestamps.NewDetachedTimestampFromPath(paths[i])
+		if err != nil {
+			readErrs[i] = err
+			return &client.Report{}
+		}
+		return verifier.ReportDetached(dts)
+	}, client.BulkOptions{
+		Workers: *flagWorkers,
+		Progress: func(i int, r *client.Report, done, total int) {
+			var status client.ReportStatus
+			if readErrs[i] != nil {
+				status = client.StatusFailed
+				lines[i] = fmt.Sprintf("failed: %v", readErrs[i])
+			} else {
+				status, lines[i] = evaluate(r, policy, since, now)
+			}
+			summary.Add(status)
+			if !*flagQuiet {
+				fmt.Fprintf(os.Stderr, "\r%d/%d", done, total)
+			}
+		},
+	})
+	if !*flagQuiet && len(paths) > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	for i, path := range paths {
+		fmt.Printf("%s: %s\n", path, lines[i])
+	}
+
+	fmt.Printf("%d proofs: %v\n", summary.Total(), summary)
+	if summary.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// evaluate returns the status of a report and a line about it, applying
+// the policy if set.
+func evaluate(
+	r *client.Report, policy *client.VerificationPolicy,
+	since *time.Time, now time.Time,
+) (client.ReportStatus, string) {
+	status := r.Status()
+	line := describe(r, status)
+	if policy != nil {
+		r.PendingSince = since
+		verdict := policy.Evaluate(r, now)
+		switch {
+		case verdict.Err() != nil:
+			status, line = client.StatusFailed, verdict.Err().Error()
+		case verdict.Pending:
+			status, line = client.StatusPending, "pending"
+		default:
+			status = client.StatusVerified
+			line = fmt.Sprintf("verified, attested time %v", verdict.Time())
+		}
+	}
+	return status, line
+}
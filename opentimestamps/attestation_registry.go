@@ -0,0 +1,149 @@
+package opentimestamps
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+// A CustomAttestation is an attestation type defined outside of this
+// package. It is registered with RegisterAttestation and handles its own
+// payload encoding.
+type CustomAttestation interface {
+	// DecodePayload parses the payload that follows the attestation tag.
+	DecodePayload(payload []byte) error
+	// EncodePayload returns the payload that follows the attestation tag.
+	EncodePayload() ([]byte, error)
+	// String is used in dumps and verification reports.
+	String() string
+}
+
+// An AttestationFactory returns a new CustomAttestation that the parser
+// decodes a payload into.
+type AttestationFactory func() CustomAttestation
+
+// A RegisteredAttestation wraps a CustomAttestation so it can be part of a
+// Timestamp.
+type RegisteredAttestation struct {
+	baseAttestation
+	Custom CustomAttestation
+}
+
+// NewRegisteredAttestation returns an attestation with the given tag, which
+// must have been registered with RegisterAttestation.
+func NewRegisteredAttestation(
+	tag []byte, c CustomAttestation,
+) (*RegisteredAttestation, error) {
+	e, ok := lookupAttestation(tag)
+	if !ok || e.factory == nil {
+		return nil, fmt.Errorf("attestation tag %x not registered", tag)
+	}
+	return &RegisteredAttestation{
+		baseAttestation: baseAttestation{e.proto.tag()},
+		Custom:          c,
+	}, nil
+}
+
+func (r *RegisteredAttestation) decode(
+	ctx *deserializationContext,
+) (Attestation, error) {
+	e, ok := lookupAttestation(r.tag())
+	if !ok || e.factory == nil {
+		return nil, fmt.Errorf("attestation tag %x not registered", r.tag())
+	}
+	payload, err := ioutil.ReadAll(ctx.r)
+	if err != nil {
+		return nil, err
+	}
+	c := e.factory()
+	if err := c.DecodePayload(payload); err != nil {
+		return nil, err
+	}
+	return &RegisteredAttestation{
+		baseAttestation: r.baseAttestation,
+		Custom:          c,
+	}, nil
+}
+
+func (r *RegisteredAttestation) encode(ctx *serializationContext) error {
+	payload, err := r.Custom.EncodePayload()
+	if err != nil {
+		return err
+	}
+	return ctx.writeBytes(payload)
+}
+
+func (r *RegisteredAttestation) String() string {
+	return r.Custom.String()
+}
+
+// AttestationTag returns the 8-byte tag of an attestation.
+func AttestationTag(a Attestation) []byte {
+	return append([]byte{}, a.tag()...)
+}
+
+type attestationEntry struct {
+	proto   Attestation
+	factory AttestationFactory
+}
+
+var attestationRegistry = struct {
+	sync.RWMutex
+	entries map[string]attestationEntry
+}{
+	entries: map[string]attestationEntry{},
+}
+
+func init() {
+	for _, a := range []Attestation{
+		newPendingAttestation(),
+		newBitcoinAttestation(),
+		newEthereumAttestation(),
+		newLitecoinAttestation(),
+	} {
+		if err := registerAttestation(a, nil); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func registerAttestation(proto Attestation, factory AttestationFactory) error {
+	tag := proto.tag()
+	if len(tag) != attestationTagSize {
+		return fmt.Errorf(
+			"attestation tag %x must be %d bytes", tag, attestationTagSize,
+		)
+	}
+	attestationRegistry.Lock()
+	defer attestationRegistry.Unlock()
+	if e, ok := attestationRegistry.entries[string(tag)]; ok {
+		return fmt.Errorf(
+			"attestation tag %x already registered for %T", tag, e.proto,
+		)
+	}
+	attestationRegistry.entries[string(tag)] = attestationEntry{
+		proto, factory,
+	}
+	return nil
+}
+
+// RegisterAttestation teaches the parser about a custom attestation type.
+// Attestations with the given tag are decoded into the CustomAttestation
+// returned by factory. It returns an error if the tag is not 8 bytes long or
+// is already registered. RegisterAttestation is safe for concurrent use.
+func RegisterAttestation(tag []byte, factory AttestationFactory) error {
+	if factory == nil {
+		return fmt.Errorf("nil factory for attestation tag %x", tag)
+	}
+	proto := &RegisteredAttestation{
+		baseAttestation: baseAttestation{append([]byte{}, tag...)},
+	}
+	return registerAttestation(proto, factory)
+}
+
+func lookupAttestation(tag []byte) (attestationEntry, bool) {
+	attestationRegistry.RLock()
+	defer attestationRegistry.RUnlock()
+	e, ok := attestationRegistry.entries[string(tag)]
+	return e, ok
+}
@@ -0,0 +1,148 @@
+package opentimestamps
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notaryAttestation is a third-party attestation used in the tests
+type notaryAttestation struct {
+	Signer string
+}
+
+func (n *notaryAttestation) DecodePayload(payload []byte) error {
+	if len(payload) == 0 {
+		return fmt.Errorf("empty signer")
+	}
+	n.Signer = string(payload)
+	return nil
+}
+
+func (n *notaryAttestation) EncodePayload() ([]byte, error) {
+	return []byte(n.Signer), nil
+}
+
+func (n *notaryAttestation) String() string {
+	return fmt.Sprintf("VERIFY NotaryAttestation(signer=%s)", n.Signer)
+}
+
+func newNotaryAttestation() CustomAttestation {
+	return &notaryAttestation{}
+}
+
+var notaryAttestationTag = mustDecodeHex("ee11223344556677")
+
+func init() {
+	err := RegisterAttestation(notaryAttestationTag, newNotaryAttestation)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisteredAttestationRoundTrip(t *testing.T) {
+	b := &timestampBuilder{}
+	b.next()
+	b.attestation(notaryAttestationTag, []byte("alice"))
+	b.height(1)
+	in := b.bytes()
+
+	ts, err := NewTimestampFromReader(bytes.NewBuffer(in), testMessage)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(ts.Attestations))
+
+	att, ok := ts.Attestations[0].(*RegisteredAttestation)
+	require.True(t, ok)
+	assert.Equal(t, notaryAttestationTag, AttestationTag(att))
+	assert.Equal(t, "alice", att.Custom.(*notaryAttestation).Signer)
+	assert.True(t, strings.Contains(
+		ts.Dump(), "VERIFY NotaryAttestation(signer=alice)",
+	))
+
+	// the attestations are encoded in canonical order, bitcoin first
+	canonical := &timestampBuilder{}
+	canonical.next()
+	canonical.height(1)
+	canonical.attestation(notaryAttestationTag, []byte("alice"))
+	out, err := ts.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, canonical.bytes(), out)
+
+	// decode errors of the custom type are reported
+	bad := &timestampBuilder{}
+	bad.attestation(notaryAttestationTag, []byte{})
+	assert.Error(t, decodeWithOptions(bad.bytes(), DefaultDecodeOptions))
+}
+
+func TestNewRegisteredAttestation(t *testing.T) {
+	att, err := NewRegisteredAttestation(
+		notaryAttestationTag, &notaryAttestation{"bob"},
+	)
+	require.NoError(t, err)
+
+	ts := &Timestamp{
+		Message:      testMessage,
+		Attestations: []Attestation{att},
+	}
+	out, err := ts.MarshalBinary()
+	require.NoError(t, err)
+
+	decoded := &Timestamp{Message: testMessage}
+	require.NoError(t, decoded.UnmarshalBinary(out))
+	assert.True(t, ts.Equal(decoded))
+
+	_, err = NewRegisteredAttestation(
+		mustDecodeHex("ee11223344556600"), &notaryAttestation{"bob"},
+	)
+	assert.Error(t, err)
+	_, err = NewRegisteredAttestation(
+		BitcoinAttestationTag, &notaryAttestation{"bob"},
+	)
+	assert.Error(t, err)
+}
+
+func TestRegisterAttestationConflicts(t *testing.T) {
+	assert.Error(t, RegisterAttestation(
+		notaryAttestationTag, newNotaryAttestation,
+	))
+	assert.Error(t, RegisterAttestation(
+		BitcoinAttestationTag, newNotaryAttestation,
+	))
+	assert.Error(t, RegisterAttestation(
+		[]byte{0x01, 0x02}, newNotaryAttestation,
+	))
+	assert.Error(t, RegisterAttestation(
+		mustDecodeHex("ee11223344556601"), nil,
+	))
+}
+
+func TestRegisterAttestationConcurrent(t *testing.T) {
+	b := &timestampBuilder{}
+	b.attestation(notaryAttestationTag, []byte("carol"))
+	in := b.bytes()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := 0; i < 32; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			tag := []byte{0xee, 0xff, 0, 0, 0, 0, 0, byte(i)}
+			errs <- RegisterAttestation(tag, newNotaryAttestation)
+		}(i)
+		go func() {
+			defer wg.Done()
+			errs <- decodeWithOptions(in, DefaultDecodeOptions)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
@@ -3,6 +3,7 @@ package opentimestamps
 import (
 	"bytes"
 	"fmt"
+	"strings"
 )
 
 const (
@@ -11,9 +12,12 @@ const (
 	pendingAttestationMaxUriLength = 1000
 )
 
+// Tags of the built-in attestation types. They must not be modified.
 var (
-	bitcoinAttestationTag = mustDecodeHex("0588960d73d71901")
-	pendingAttestationTag = mustDecodeHex("83dfe30d2ef90c8e")
+	BitcoinAttestationTag  = mustDecodeHex("0588960d73d71901")
+	PendingAttestationTag  = mustDecodeHex("83dfe30d2ef90c8e")
+	EthereumAttestationTag = mustDecodeHex("30fe8087b5c7ead7")
+	LitecoinAttestationTag = mustDecodeHex("06869a0d73d71b45")
 )
 
 type Attestation interface {
@@ -38,7 +42,7 @@ type pendingAttestation struct {
 func newPendingAttestation() *pendingAttestation {
 	return &pendingAttestation{
 		baseAttestation: baseAttestation{
-			fixedTag: pendingAttestationTag,
+			fixedTag: PendingAttestationTag,
 		},
 	}
 }
@@ -60,6 +64,21 @@ func (p *pendingAttestation) encode(ctx *serializationContext) error {
 	return ctx.writeVarBytes([]byte(p.uri))
 }
 
+// URI returns the calendar URI the attestation can be upgraded from.
+func (p *pendingAttestation) URI() string {
+	return p.uri
+}
+
+// PendingURI returns the calendar URI of a pending attestation, and false if
+// the attestation is not pending.
+func PendingURI(a Attestation) (string, bool) {
+	p, ok := a.(*pendingAttestation)
+	if !ok {
+		return "", false
+	}
+	return p.uri, true
+}
+
 func (p *pendingAttestation) String() string {
 	return fmt.Sprintf("VERIFY PendingAttestation(url=%s)", p.uri)
 }
@@ -71,7 +90,7 @@ type BitcoinAttestation struct {
 
 func newBitcoinAttestation() *BitcoinAttestation {
 	return &BitcoinAttestation{
-		baseAttestation: baseAttestation{bitcoinAttestationTag},
+		baseAttestation: baseAttestation{BitcoinAttestationTag},
 	}
 }
 
@@ -97,7 +116,6 @@ func (b *BitcoinAttestation) encode(ctx *serializationContext) error {
 
 const hashMerkleRootSize = 32
 
-//
 func (b *BitcoinAttestation) VerifyAgainstBlockHash(
 	digest, blockHash []byte,
 ) error {
@@ -113,6 +131,108 @@ func (b *BitcoinAttestation) VerifyAgainstBlockHash(
 	return nil
 }
 
+// An EthereumAttestation commits to the transactions root of an ethereum
+// block header, as defined by javascript-opentimestamps.
+type EthereumAttestation struct {
+	baseAttestation
+	Height uint64
+}
+
+func newEthereumAttestation() *EthereumAttestation {
+	return &EthereumAttestation{
+		baseAttestation: baseAttestation{EthereumAttestationTag},
+	}
+}
+
+func (e *EthereumAttestation) String() string {
+	return fmt.Sprintf("VERIFY EthereumAttestation(height=%d)", e.Height)
+}
+
+func (e *EthereumAttestation) decode(
+	ctx *deserializationContext,
+) (Attestation, error) {
+	height, err := ctx.readVarUint()
+	if err != nil {
+		return nil, err
+	}
+	ret := *e
+	ret.Height = height
+	return &ret, nil
+}
+
+func (e *EthereumAttestation) encode(ctx *serializationContext) error {
+	return ctx.writeVarUint(e.Height)
+}
+
+const transactionsRootSize = 32
+
+// VerifyAgainstTransactionsRoot checks that the digest equals the
+// transactions root of the attested block.
+func (e *EthereumAttestation) VerifyAgainstTransactionsRoot(
+	digest, transactionsRoot []byte,
+) error {
+	if len(digest) != transactionsRootSize {
+		return fmt.Errorf("invalid digest size %d", len(digest))
+	}
+	if !bytes.Equal(digest, transactionsRoot) {
+		return fmt.Errorf(
+			"hash mismatch digest=%x transactionsRoot=%x",
+			digest, transactionsRoot,
+		)
+	}
+	return nil
+}
+
+// A LitecoinAttestation commits to the merkle root of a litecoin block
+// header. Litecoin headers use the same format as bitcoin headers.
+type LitecoinAttestation struct {
+	baseAttestation
+	Height uint64
+}
+
+func newLitecoinAttestation() *LitecoinAttestation {
+	return &LitecoinAttestation{
+		baseAttestation: baseAttestation{LitecoinAttestationTag},
+	}
+}
+
+func (l *LitecoinAttestation) String() string {
+	return fmt.Sprintf("VERIFY LitecoinAttestation(height=%d)", l.Height)
+}
+
+func (l *LitecoinAttestation) decode(
+	ctx *deserializationContext,
+) (Attestation, error) {
+	height, err := ctx.readVarUint()
+	if err != nil {
+		return nil, err
+	}
+	ret := *l
+	ret.Height = height
+	return &ret, nil
+}
+
+func (l *LitecoinAttestation) encode(ctx *serializationContext) error {
+	return ctx.writeVarUint(l.Height)
+}
+
+// VerifyAgainstBlockHash checks that the digest equals the merkle root of the
+// attested block.
+func (l *LitecoinAttestation) VerifyAgainstBlockHash(
+	digest, blockHash []byte,
+) error {
+	if len(digest) != hashMerkleRootSize {
+		return fmt.Errorf("invalid digest size %d", len(digest))
+	}
+	if !bytes.Equal(digest, blockHash) {
+		return fmt.Errorf(
+			"hash mismatch digest=%x blockHash=%x",
+			digest, blockHash,
+		)
+	}
+	return nil
+}
+
 // This is a catch-all for when we don't know how to parse it
 type unknownAttestation struct {
 	tagBytes []byte
@@ -123,21 +243,55 @@ func (u unknownAttestation) tag() []byte {
 	return u.tagBytes
 }
 
-func (unknownAttestation) decode(*deserializationContext) (Attestation, error) {
-	panic("not implemented")
+func (u unknownAttestation) decode(*deserializationContext) (Attestation, error) {
+	return nil, fmt.Errorf("cannot decode unknown attestation %x", u.tagBytes)
 }
 
-func (unknownAttestation) encode(*serializationContext) error {
-	panic("not implemented")
+// encode writes the payload as it was read
+func (u unknownAttestation) encode(ctx *serializationContext) error {
+	return ctx.writeBytes(u.bytes)
 }
 
 func (u unknownAttestation) String() string {
 	return fmt.Sprintf("UnknownAttestation(bytes=%q)", u.bytes)
 }
 
-var attestations []Attestation = []Attestation{
-	newPendingAttestation(),
-	newBitcoinAttestation(),
+// compareAttestations orders attestations by tag and then by their
+// type-specific value, like the reference implementation does.
+func compareAttestations(a, b Attestation) int {
+	if c := bytes.Compare(a.tag(), b.tag()); c != 0 {
+		return c
+	}
+	switch a := a.(type) {
+	case *pendingAttestation:
+		return strings.Compare(a.uri, b.(*pendingAttestation).uri)
+	case *BitcoinAttestation:
+		return compareHeights(a.Height, b.(*BitcoinAttestation).Height)
+	case *EthereumAttestation:
+		return compareHeights(a.Height, b.(*EthereumAttestation).Height)
+	case *LitecoinAttestation:
+		return compareHeights(a.Height, b.(*LitecoinAttestation).Height)
+	case unknownAttestation:
+		return bytes.Compare(a.bytes, b.(unknownAttestation).bytes)
+	}
+	return bytes.Compare(encodedPayload(a), encodedPayload(b))
+}
+
+// attestationsEqual returns true if both attestations have the same tag and
+// payload.
+func attestationsEqual(a, b Attestation) bool {
+	return bytes.Equal(a.tag(), b.tag()) &&
+		bytes.Equal(encodedPayload(a), encodedPayload(b))
+}
+
+func compareHeights(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
 }
 
 func encodeAttestation(ctx *serializationContext, att Attestation) error {
@@ -163,21 +317,20 @@ func ParseAttestation(ctx *deserializationContext) (Attestation, error) {
 	if err != nil {
 		return nil, err
 	}
-	attCtx := newDeserializationContext(
-		bytes.NewBuffer(attBytes),
+	attCtx := newDeserializationContextWithOptions(
+		bytes.NewBuffer(attBytes), ctx.opts,
 	)
 
-	for _, a := range attestations {
-		if bytes.Equal(tag, a.tag()) {
-			att, err := a.decode(attCtx)
-			if err != nil {
-				return nil, err
-			}
-			if !attCtx.assertEOF() {
-				return nil, fmt.Errorf("expected EOF in attCtx")
-			}
-			return att, nil
-		}
-	}
-	return unknownAttestation{tag, attBytes}, nil
+	e, ok := lookupAttestation(tag)
+	if !ok {
+		return unknownAttestation{tag, attBytes}, nil
+	}
+	att, err := e.proto.decode(attCtx)
+	if err != nil {
+		return nil, err
+	}
+	if !attCtx.assertEOF() {
+		return nil, fmt.Errorf("expected EOF in attCtx")
+	}
+	return att, nil
 }
@@ -0,0 +1,94 @@
+package opentimestamps
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// calendarExpvarName is the expvar map the default hooks publish to.
+const calendarExpvarName = "opentimestamps_calendars"
+
+// A Logger receives the log messages of a RemoteCalendar. A logrus.Logger
+// or logrus.Entry can be used directly.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// A CalendarRequest describes a finished request to a calendar.
+type CalendarRequest struct {
+	// Calendar is the base URL of the calendar.
+	Calendar string
+	Method   string
+	Path     string
+	// StatusCode is the HTTP status of the response, or zero if there was
+	// no response.
+	StatusCode int
+	// Latency is the time from sending the request to decoding the
+	// returned timestamp.
+	Latency time.Duration
+	// Err is the reason the request failed, or nil.
+	Err error
+}
+
+// CalendarHooks are notified of the requests of a RemoteCalendar. They are
+// called from the goroutine making the request and must be safe for
+// concurrent use.
+type CalendarHooks interface {
+	RequestDone(r *CalendarRequest)
+}
+
+// ExpvarCalendarHooks count the requests, failures, statuses and total
+// latency of each calendar in an expvar.Map keyed by calendar URL.
+type ExpvarCalendarHooks struct {
+	mu   sync.Mutex
+	vars *expvar.Map
+}
+
+// NewExpvarCalendarHooks returns hooks adding to vars, which is usually
+// created with expvar.NewMap.
+func NewExpvarCalendarHooks(vars *expvar.Map) *ExpvarCalendarHooks {
+	return &ExpvarCalendarHooks{vars: vars}
+}
+
+// calendarVars returns the map of the calendar, creating it if needed.
+func (h *ExpvarCalendarHooks) calendarVars(calendar string) *expvar.Map {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if m, ok := h.vars.Get(calendar).(*expvar.Map); ok {
+		return m
+	}
+	m := new(expvar.Map).Init()
+	h.vars.Set(calendar, m)
+	return m
+}
+
+// RequestDone counts the request in the map of its calendar.
+func (h *ExpvarCalendarHooks) RequestDone(r *CalendarRequest) {
+	m := h.calendarVars(r.Calendar)
+
+	m.Add("requests", 1)
+	if r.Err != nil {
+		m.Add("errors", 1)
+	}
+	if r.StatusCode != 0 {
+		m.Add("status_"+strconv.Itoa(r.StatusCode), 1)
+	}
+	m.Add("latency_ns", int64(r.Latency))
+}
+
+var (
+	defaultHooksOnce sync.Once
+	defaultHooks     CalendarHooks
+)
+
+// defaultCalendarHooks returns the hooks of calendars created without
+// WithHooks. They publish to the expvar map "opentimestamps_calendars".
+func defaultCalendarHooks() CalendarHooks {
+	defaultHooksOnce.Do(func() {
+		defaultHooks = NewExpvarCalendarHooks(expvar.NewMap(calendarExpvarName))
+	})
+	return defaultHooks
+}
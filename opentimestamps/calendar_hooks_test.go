@@ -0,0 +1,106 @@
+package opentimestamps
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, "debug: "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, "error: "+fmt.Sprintf(format, args...))
+}
+
+type recordingHooks struct {
+	mu       sync.Mutex
+	requests []CalendarRequest
+}
+
+func (h *recordingHooks) RequestDone(r *CalendarRequest) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests = append(h.requests, *r)
+}
+
+func TestCalendarLoggerAndHooks(t *testing.T) {
+	server := newFakeCalendar(t)
+	defer server.Close()
+	failing := httptest.NewServer(http.NotFoundHandler())
+	defer failing.Close()
+
+	logger := &recordingLogger{}
+	hooks := &recordingHooks{}
+	cal, err := NewRemoteCalendar(
+		server.URL, WithLogger(logger), WithHooks(hooks),
+	)
+	require.NoError(t, err)
+	commitment := newTestDigest("hooks")
+	_, err = cal.GetTimestamp(commitment)
+	require.NoError(t, err)
+
+	bad, err := NewRemoteCalendar(
+		failing.URL, WithLogger(logger), WithHooks(hooks),
+	)
+	require.NoError(t, err)
+	_, err = bad.GetTimestamp(commitment)
+	require.Error(t, err)
+
+	require.Equal(t, 2, len(hooks.requests))
+	r := hooks.requests[0]
+	assert.Equal(t, server.URL+"/", r.Calendar)
+	assert.Equal(t, "GET", r.Method)
+	assert.Equal(t, fmt.Sprintf("timestamp/%x", commitment), r.Path)
+	assert.Equal(t, http.StatusOK, r.StatusCode)
+	assert.True(t, r.Latency > 0)
+	assert.NoError(t, r.Err)
+	assert.Equal(t, http.StatusNotFound, hooks.requests[1].StatusCode)
+	assert.Error(t, hooks.requests[1].Err)
+
+	require.Equal(t, 4, len(logger.messages))
+	assert.Contains(t, logger.messages[0], "debug: > GET "+server.URL)
+}
+
+func TestExpvarCalendarHooks(t *testing.T) {
+	vars := new(expvar.Map).Init()
+	hooks := NewExpvarCalendarHooks(vars)
+	hooks.RequestDone(&CalendarRequest{
+		Calendar: "a", StatusCode: 200, Latency: 3,
+	})
+	hooks.RequestDone(&CalendarRequest{
+		Calendar: "a", StatusCode: 404, Latency: 4, Err: fmt.Errorf("x"),
+	})
+	hooks.RequestDone(&CalendarRequest{Calendar: "b", Err: fmt.Errorf("x")})
+
+	a := vars.Get("a").(*expvar.Map)
+	assert.Equal(t, "2", a.Get("requests").String())
+	assert.Equal(t, "1", a.Get("errors").String())
+	assert.Equal(t, "1", a.Get("status_200").String())
+	assert.Equal(t, "1", a.Get("status_404").String())
+	assert.Equal(t, "7", a.Get("latency_ns").String())
+	b := vars.Get("b").(*expvar.Map)
+	assert.Equal(t, "1", b.Get("errors").String())
+	assert.Nil(t, b.Get("status_0"))
+
+	// calendars without hooks count to the published map
+	_, err := NewRemoteCalendar("localhost")
+	require.NoError(t, err)
+	assert.NotNil(t, expvar.Get(calendarExpvarName))
+}
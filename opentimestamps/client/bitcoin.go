@@ -3,49 +3,262 @@ package client
 import (
 	"fmt"
 	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
-	"github.com/btcsuite/btcrpcclient"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 )
 
-// A BitcoinAttestationVerifier uses a bitcoin RPC connection to verify bitcoin
-// headers.
+// A BlockHeaderSource looks up block headers of a bitcoin-like chain. It is
+// implemented by *btcrpcclient.Client, which also works with litecoind.
+type BlockHeaderSource interface {
+	GetBlockHash(blockHeight int64) (*chainhash.Hash, error)
+	GetBlockHeader(blockHash *chainhash.Hash) (*wire.BlockHeader, error)
+}
+
+// getBlockHeader returns the header of the block at the given height.
+func getBlockHeader(
+	s BlockHeaderSource, height uint64,
+) (*wire.BlockHeader, error) {
+	if height > math.MaxInt64 {
+		return nil, fmt.Errorf("illegal block height")
+	}
+	blockHash, err := s.GetBlockHash(int64(height))
+	if err != nil {
+		return nil, err
+	}
+	return s.GetBlockHeader(blockHash)
+}
+
+// A BlockCountSource reports the height of the best chain. It is implemented
+// by *btcrpcclient.Client.
+type BlockCountSource interface {
+	GetBlockCount() (int64, error)
+}
+
+// blockConfirmations returns the number of blocks on top of and including
+// the block at the given height. The source must implement BlockCountSource.
+func blockConfirmations(s BlockHeaderSource, height uint64) (int64, error) {
+	c, ok := s.(BlockCountSource)
+	if !ok {
+		return 0, fmt.Errorf("%T cannot report the block count", s)
+	}
+	count, err := c.GetBlockCount()
+	if err != nil {
+		return 0, err
+	}
+	if height > math.MaxInt64 || int64(height) > count {
+		return 0, fmt.Errorf(
+			"block height %d above best height %d", height, count,
+		)
+	}
+	return count - int64(height) + 1, nil
+}
+
+// A BitcoinBlock is the block a BitcoinAttestation was verified against.
+type BitcoinBlock struct {
+	Hash   chainhash.Hash
+	Header *wire.BlockHeader
+	// Confirmations is the number of blocks on top of and including this
+	// block, or zero if the header source cannot report the best height.
+	Confirmations int64
+	// MedianTimePast is the median time of the previous 11 blocks. The
+	// header time is always later.
+	MedianTimePast time.Time
+	// MaxNextTime is the maximum header time of the following blocks, or
+	// nil if there are none yet.
+	MaxNextTime *time.Time
+}
+
+// Interval returns the bounds of the block creation time.
+func (b *BitcoinBlock) Interval() TimeInterval {
+	latest := b.Header.Timestamp.UTC()
+	if b.MaxNextTime != nil && b.MaxNextTime.After(latest) {
+		latest = *b.MaxNextTime
+	}
+	return TimeInterval{Earliest: b.MedianTimePast, Latest: latest}
+}
+
+// lookupBlock returns the block at the given height. If the source is a
+// BlockCountSource, the confirmations are counted as well, and the block
+// hash is checked again afterwards so a reorg during the lookup is noticed.
+func lookupBlock(s BlockHeaderSource, height uint64) (*BitcoinBlock, error) {
+	if height > math.MaxInt64 {
+		return nil, fmt.Errorf("illegal block height")
+	}
+	blockHash, err := s.GetBlockHash(int64(height))
+	if err != nil {
+		return nil, err
+	}
+	h, err := s.GetBlockHeader(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	block := &BitcoinBlock{Hash: *blockHash, Header: h}
+	if _, ok := s.(BlockCountSource); !ok {
+		return block, nil
+	}
+	block.Confirmations, err = blockConfirmations(s, height)
+	if err != nil {
+		return nil, err
+	}
+	recheck, err := s.GetBlockHash(int64(height))
+	if err != nil {
+		return nil, err
+	}
+	if !recheck.IsEqual(blockHash) {
+		return nil, fmt.Errorf(
+			"block at height %d changed from %v to %v during verification",
+			height, blockHash, recheck,
+		)
+	}
+	return block, nil
+}
+
+// A ConfirmationsError is returned or reported as a warning when an
+// attested block has fewer confirmations than required.
+type ConfirmationsError struct {
+	Height        uint64
+	Confirmations int64
+	Required      int64
+}
+
+func (e *ConfirmationsError) Error() string {
+	return fmt.Sprintf(
+		"block %d has %d confirmations, %d required",
+		e.Height, e.Confirmations, e.Required,
+	)
+}
+
+// A BitcoinAttestationVerifier uses a bitcoin RPC connection or another
+// BlockHeaderSource to verify bitcoin headers.
 type BitcoinAttestationVerifier struct {
-	btcrpcClient *btcrpcclient.Client
+	btcrpcClient BlockHeaderSource
+	// MinConfirmations is the number of confirmations an attested block
+	// needs. The header source must implement BlockCountSource if it is
+	// set.
+	MinConfirmations int64
+	// WarnOnly reports attestations with too few confirmations as a
+	// warning instead of failing their verification.
+	WarnOnly bool
+	// TimeBounds looks up the previous and following blocks of attested
+	// blocks to bound the attestation time, at the cost of up to 11 +
+	// NextBlocks further header lookups per block. VerifyInterval always
+	// does.
+	TimeBounds bool
+	// NextBlocks is the number of following blocks whose header times are
+	// used for the upper bound of the attestation time.
+	NextBlocks int
+	// Network is the network attestations are expected on. If set, the
+	// header source is checked to follow it before the first verification.
+	Network *BitcoinNetwork
+
+	// networkChecked is set once the network check passed
+	networkChecked uint32
 }
 
 func NewBitcoinAttestationVerifier(
-	c *btcrpcclient.Client,
+	c BlockHeaderSource,
 ) *BitcoinAttestationVerifier {
-	return &BitcoinAttestationVerifier{c}
+	return &BitcoinAttestationVerifier{
+		btcrpcClient: c,
+		NextBlocks:   defaultNextBlocks,
+	}
 }
 
-// VerifyAttestation checks a BitcoinAttestation using a given hash digest. It
-// returns the time of the block if the verification succeeds, an error
-// otherwise.
-func (v *BitcoinAttestationVerifier) VerifyAttestation(
-	digest []byte, a *opentimestamps.BitcoinAttestation,
-) (*time.Time, error) {
-	if a.Height > math.MaxInt64 {
-		return nil, fmt.Errorf("illegal block height")
+// checkNetwork returns an error if the header source doesn't follow the
+// network of the verifier.
+func (v *BitcoinAttestationVerifier) checkNetwork() error {
+	if v.Network == nil || atomic.LoadUint32(&v.networkChecked) == 1 {
+		return nil
+	}
+	if err := v.Network.Check(v.btcrpcClient); err != nil {
+		return err
+	}
+	atomic.StoreUint32(&v.networkChecked, 1)
+	return nil
+}
+
+// fetchBlock looks up the block at the given height, with its time bounds
+// if bounds is set.
+func (v *BitcoinAttestationVerifier) fetchBlock(
+	height uint64, bounds bool,
+) (*BitcoinBlock, error) {
+	if err := v.checkNetwork(); err != nil {
+		return nil, err
+	}
+	if v.MinConfirmations > 0 {
+		if _, ok := v.btcrpcClient.(BlockCountSource); !ok {
+			return nil, fmt.Errorf(
+				"%T cannot report the block count", v.btcrpcClient,
+			)
+		}
 	}
-	blockHash, err := v.btcrpcClient.GetBlockHash(int64(a.Height))
+	block, err := lookupBlock(v.btcrpcClient, height)
 	if err != nil {
 		return nil, err
 	}
-	h, err := v.btcrpcClient.GetBlockHeader(blockHash)
+	if !bounds {
+		return block, nil
+	}
+	err = blockTimes(v.btcrpcClient, height, block, v.NextBlocks)
 	if err != nil {
 		return nil, err
 	}
+	return block, nil
+}
 
-	merkleRootBytes := h.MerkleRoot[:]
-	err = a.VerifyAgainstBlockHash(digest, merkleRootBytes)
+// checkBlock verifies the attestation against a fetched block.
+func (v *BitcoinAttestationVerifier) checkBlock(
+	digest []byte, a *opentimestamps.BitcoinAttestation, block *BitcoinBlock,
+) (warning, err error) {
+	err = a.VerifyAgainstBlockHash(digest, block.Header.MerkleRoot[:])
 	if err != nil {
 		return nil, err
 	}
-	utc := h.Timestamp.UTC()
+	if block.Confirmations < v.MinConfirmations {
+		confErr := &ConfirmationsError{
+			a.Height, block.Confirmations, v.MinConfirmations,
+		}
+		if !v.WarnOnly {
+			return nil, confErr
+		}
+		return confErr, nil
+	}
+	return nil, nil
+}
+
+// VerifyAttestationBlock checks a BitcoinAttestation using a given hash
+// digest. It returns the block the attestation was verified against, with
+// its time bounds if TimeBounds is set, and a *ConfirmationsError as a
+// warning if the block has too few confirmations and WarnOnly is set.
+func (v *BitcoinAttestationVerifier) VerifyAttestationBlock(
+	digest []byte, a *opentimestamps.BitcoinAttestation,
+) (block *BitcoinBlock, warning, err error) {
+	block, err = v.fetchBlock(a.Height, v.TimeBounds)
+	if err != nil {
+		return nil, nil, err
+	}
+	warning, err = v.checkBlock(digest, a, block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, warning, nil
+}
 
+// VerifyAttestation checks a BitcoinAttestation using a given hash digest. It
+// returns the header time of the block if the verification succeeds, an
+// error otherwise.
+func (v *BitcoinAttestationVerifier) VerifyAttestation(
+	digest []byte, a *opentimestamps.BitcoinAttestation,
+) (*time.Time, error) {
+	block, _, err := v.VerifyAttestationBlock(digest, a)
+	if err != nil {
+		return nil, err
+	}
+	utc := block.Header.Timestamp.UTC()
 	return &utc, nil
 }
 
@@ -54,13 +267,53 @@ type BitcoinVerification struct {
 	Timestamp       *opentimestamps.Timestamp
 	Attestation     *opentimestamps.BitcoinAttestation
 	AttestationTime *time.Time
-	Error           error
+	// Interval bounds the attestation time, if the bounds were looked up.
+	Interval *TimeInterval
+	Error    error
+	// BlockHash is the hash of the block used for the verification. It
+	// can be used to check for reorgs later.
+	BlockHash     *chainhash.Hash
+	Confirmations int64
+	Warning       error
+}
+
+// newBitcoinVerification returns the result of checking the attestation
+// against a block, or the error from fetching the block.
+func (v *BitcoinAttestationVerifier) newBitcoinVerification(
+	ts *opentimestamps.Timestamp, a *opentimestamps.BitcoinAttestation,
+	block *BitcoinBlock, err error, bounds bool,
+) BitcoinVerification {
+	r := BitcoinVerification{Timestamp: ts, Attestation: a}
+	var warning error
+	if err == nil {
+		warning, err = v.checkBlock(ts.Message, a, block)
+	}
+	if err != nil {
+		r.Error = err
+		return r
+	}
+	utc := block.Header.Timestamp.UTC()
+	r.AttestationTime = &utc
+	if bounds {
+		interval := block.Interval()
+		r.Interval = &interval
+	}
+	r.BlockHash = &block.Hash
+	r.Confirmations = block.Confirmations
+	r.Warning = warning
+	return r
 }
 
 // BitcoinVerifications returns the all bitcoin attestation results for the
-// timestamp.
+// timestamp, with their time bounds if TimeBounds is set.
 func (v *BitcoinAttestationVerifier) BitcoinVerifications(
 	t *opentimestamps.Timestamp,
+) []BitcoinVerification {
+	return v.verifications(t, v.TimeBounds)
+}
+
+func (v *BitcoinAttestationVerifier) verifications(
+	t *opentimestamps.Timestamp, bounds bool,
 ) (res []BitcoinVerification) {
 	t.Walk(func(ts *opentimestamps.Timestamp) {
 		for _, att := range ts.Attestations {
@@ -68,13 +321,10 @@ func (v *BitcoinAttestationVerifier) BitcoinVerifications(
 			if !ok {
 				continue
 			}
-			attTime, err := v.VerifyAttestation(ts.Message, btcAtt)
-			res = append(res, BitcoinVerification{
-				Timestamp:       ts,
-				Attestation:     btcAtt,
-				AttestationTime: attTime,
-				Error:           err,
-			})
+			block, err := v.fetchBlock(btcAtt.Height, bounds)
+			res = append(
+				res, v.newBitcoinVerification(ts, btcAtt, block, err, bounds),
+			)
 		}
 	})
 	return res
@@ -85,7 +335,7 @@ func (v *BitcoinAttestationVerifier) BitcoinVerifications(
 func (v *BitcoinAttestationVerifier) Verify(
 	t *opentimestamps.Timestamp,
 ) (ret *time.Time, err error) {
-	res := v.BitcoinVerifications(t)
+	res := v.verifications(t, false)
 	for _, r := range res {
 		if r.Error != nil {
 			err = r.Error
@@ -97,3 +347,22 @@ func (v *BitcoinAttestationVerifier) Verify(
 	}
 	return
 }
+
+// VerifyInterval returns the interval of the earliest bitcoin-attested block,
+// or nil if none can be found or verified successfully. The timestamp existed
+// no later than the end of the interval.
+func (v *BitcoinAttestationVerifier) VerifyInterval(
+	t *opentimestamps.Timestamp,
+) (ret *TimeInterval, err error) {
+	res := v.verifications(t, true)
+	for _, r := range res {
+		if r.Error != nil {
+			err = r.Error
+			continue
+		}
+		if ret == nil || r.Interval.Latest.Before(ret.Latest) {
+			ret = r.Interval
+		}
+	}
+	return
+}
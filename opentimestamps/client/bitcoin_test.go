@@ -1,6 +1,7 @@
 package client
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"net/url"
 	"os"
@@ -8,6 +9,8 @@ import (
 	"time"
 
 	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcrpcclient"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -64,7 +67,7 @@ func TestVerifyHelloWorld(t *testing.T) {
 	btcConn, err := newTestBTCConn()
 	require.NoError(t, err)
 
-	verifier := BitcoinAttestationVerifier{btcConn}
+	verifier := NewBitcoinAttestationVerifier(btcConn)
 
 	// using BitcoinVerifications()
 	results := verifier.BitcoinVerifications(ts)
@@ -80,4 +83,207 @@ func TestVerifyHelloWorld(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, verifiedTime)
 	assert.Equal(t, expectedTime, verifiedTime.Format(time.RFC3339))
+
+	// using VerifyInterval()
+	interval, err := verifier.VerifyInterval(ts)
+	require.NoError(t, err)
+	require.NotNil(t, interval)
+	assert.False(t, interval.Latest.Before(*result0.AttestationTime))
+	assert.True(t, interval.Earliest.Before(*result0.AttestationTime))
+}
+
+func TestBitcoinVerifierConfirmations(t *testing.T) {
+	message := []byte("hello confirmations")
+	digest := sha256.Sum256(message)
+	blockTime := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	source := newFakeHeaderSource()
+	header := &wire.BlockHeader{
+		MerkleRoot: chainhash.Hash(digest),
+		Timestamp:  blockTime,
+	}
+	source.add(100, header)
+	source.add(102, &wire.BlockHeader{})
+	source.fill(102)
+	ts := newAttestedTimestamp(t, message, bitcoinTag, 100)
+
+	verifier := NewBitcoinAttestationVerifier(source)
+	results := verifier.BitcoinVerifications(ts)
+	require.Equal(t, 1, len(results))
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, int64(3), results[0].Confirmations)
+	assert.Equal(t, header.BlockHash(), *results[0].BlockHash)
+	assert.NoError(t, results[0].Warning)
+
+	verifier.MinConfirmations = 4
+	results = verifier.BitcoinVerifications(ts)
+	require.Equal(t, 1, len(results))
+	assert.IsType(t, &ConfirmationsError{}, results[0].Error)
+	assert.Nil(t, results[0].AttestationTime)
+	_, err := verifier.Verify(ts)
+	assert.Error(t, err)
+
+	verifier.WarnOnly = true
+	results = verifier.BitcoinVerifications(ts)
+	require.Equal(t, 1, len(results))
+	require.NoError(t, results[0].Error)
+	assert.IsType(t, &ConfirmationsError{}, results[0].Warning)
+	assert.Equal(t, blockTime, *results[0].AttestationTime)
+
+	multi, err := NewMultiVerifier(verifier)
+	require.NoError(t, err)
+	report := multi.Report(ts)
+	require.Equal(t, 1, len(report.Results))
+	assert.Equal(t, header.BlockHash().String(), report.Results[0].BlockHash)
+	assert.Equal(t, int64(3), report.Results[0].Confirmations)
+	assert.Equal(t, 1, len(report.Warnings()))
+
+	// the threshold requires a source that knows the best height
+	verifier = NewBitcoinAttestationVerifier(headersOnly{source})
+	_, err = verifier.Verify(ts)
+	assert.NoError(t, err)
+	verifier.MinConfirmations = 1
+	_, err = verifier.Verify(ts)
+	assert.Error(t, err)
+}
+
+// headersOnly hides the GetBlockCount method of a fakeHeaderSource
+type headersOnly struct {
+	s *fakeHeaderSource
+}
+
+func (h headersOnly) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	return h.s.GetBlockHash(height)
+}
+
+func (h headersOnly) GetBlockHeader(
+	hash *chainhash.Hash,
+) (*wire.BlockHeader, error) {
+	return h.s.GetBlockHeader(hash)
+}
+
+// reorgSource replaces the block at a height after the first lookup
+type reorgSource struct {
+	*fakeHeaderSource
+	height int64
+	header *wire.BlockHeader
+}
+
+func (r *reorgSource) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	hash, err := r.fakeHeaderSource.GetBlockHash(height)
+	if height == r.height && r.header != nil {
+		r.add(height, r.header)
+		r.header = nil
+	}
+	return hash, err
+}
+
+func TestBitcoinVerifierReorg(t *testing.T) {
+	message := []byte("hello reorg")
+	digest := sha256.Sum256(message)
+
+	source := &reorgSource{
+		fakeHeaderSource: newFakeHeaderSource(),
+		height:           100,
+		header:           &wire.BlockHeader{Nonce: 1},
+	}
+	source.add(100, &wire.BlockHeader{MerkleRoot: chainhash.Hash(digest)})
+	source.add(105, &wire.BlockHeader{})
+	source.fill(105)
+
+	verifier := NewBitcoinAttestationVerifier(source)
+	ts := newAttestedTimestamp(t, message, bitcoinTag, 100)
+	_, err := verifier.Verify(ts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "changed")
+}
+
+func TestBitcoinBlockTimes(t *testing.T) {
+	message := []byte("hello block times")
+	digest := sha256.Sum256(message)
+	base := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	// times of the previous blocks are out of order, the median of the
+	// last 11 is base+5m
+	source := newFakeHeaderSource()
+	prevMinutes := []int{9, 1, 8, 2, 7, 3, 6, 4, 5, 0, 10}
+	for i, m := range prevMinutes {
+		source.add(int64(90+i), &wire.BlockHeader{
+			Nonce:     uint32(i),
+			Timestamp: base.Add(time.Duration(m) * time.Minute),
+		})
+	}
+	header := &wire.BlockHeader{
+		MerkleRoot: chainhash.Hash(digest),
+		Timestamp:  base.Add(20 * time.Minute),
+	}
+	source.add(101, header)
+	source.fill(101)
+	ts := newAttestedTimestamp(t, message, bitcoinTag, 101)
+	verifier := NewBitcoinAttestationVerifier(source)
+
+	// no following blocks yet
+	interval, err := verifier.VerifyInterval(ts)
+	require.NoError(t, err)
+	assert.Equal(t, TimeInterval{
+		Earliest: base.Add(5 * time.Minute),
+		Latest:   base.Add(20 * time.Minute),
+	}, *interval)
+
+	// a following block with an earlier time doesn't change the bound
+	source.add(102, &wire.BlockHeader{Timestamp: base.Add(15 * time.Minute)})
+	interval, err = verifier.VerifyInterval(ts)
+	require.NoError(t, err)
+	assert.Equal(t, base.Add(20*time.Minute), interval.Latest)
+
+	// a later one does
+	source.add(103, &wire.BlockHeader{Timestamp: base.Add(40 * time.Minute)})
+	interval, err = verifier.VerifyInterval(ts)
+	require.NoError(t, err)
+	assert.Equal(t, base.Add(40*time.Minute), interval.Latest)
+
+	// but only if it's within NextBlocks
+	verifier.NextBlocks = 1
+	interval, err = verifier.VerifyInterval(ts)
+	require.NoError(t, err)
+	assert.Equal(t, base.Add(20*time.Minute), interval.Latest)
+
+	results := verifier.BitcoinVerifications(ts)
+	require.Equal(t, 1, len(results))
+	assert.Equal(t, header.Timestamp, *results[0].AttestationTime)
+	assert.Nil(t, results[0].Interval)
+
+	verifier.TimeBounds = true
+	results = verifier.BitcoinVerifications(ts)
+	require.Equal(t, 1, len(results))
+	assert.Equal(t, interval, results[0].Interval)
+	multi, err := NewMultiVerifier(verifier)
+	require.NoError(t, err)
+	assert.Equal(t, interval, multi.Report(ts).Interval())
+}
+
+func TestBitcoinBlockTimesOptIn(t *testing.T) {
+	message := []byte("hello lookups")
+	digest := sha256.Sum256(message)
+	source := newCountingSource(110)
+	source.add(100, &wire.BlockHeader{MerkleRoot: chainhash.Hash(digest)})
+	ts := newAttestedTimestamp(t, message, bitcoinTag, 100)
+	verifier := NewBitcoinAttestationVerifier(source)
+
+	// hash, header and the hash again after counting the confirmations
+	_, err := verifier.Verify(ts)
+	require.NoError(t, err)
+	assert.Equal(t, 3, source.calls())
+
+	multi, err := NewMultiVerifier(verifier)
+	require.NoError(t, err)
+	report := multi.Report(ts)
+	assert.NotNil(t, report.Time())
+	assert.Nil(t, report.Interval())
+	assert.Equal(t, 6, source.calls())
+
+	// the previous and following blocks are only looked up on request
+	_, err = verifier.VerifyInterval(ts)
+	require.NoError(t, err)
+	assert.Equal(t, 6+3+2*(medianTimeBlocks+defaultNextBlocks), source.calls())
 }
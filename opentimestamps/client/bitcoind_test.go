@@ -0,0 +1,136 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBitcoinConf = `
+# global options
+rpcconnect=10.0.0.1
+rpcport=9332 # mainnet only
+rpcuser=alice
+rpcpassword=secret
+
+[test]
+rpcpassword=testsecret
+
+[regtest]
+rpcuser=
+rpcpassword=
+rpccookiefile=other.cookie
+signet.rpcport=39332
+`
+
+func TestReadBitcoinConf(t *testing.T) {
+	opts, err := ReadBitcoinConf(strings.NewReader(testBitcoinConf), BitcoinMainnet)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"rpcconnect":  "10.0.0.1",
+		"rpcport":     "9332",
+		"rpcuser":     "alice",
+		"rpcpassword": "secret",
+	}, opts)
+
+	opts, err = ReadBitcoinConf(strings.NewReader(testBitcoinConf), BitcoinTestnet)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"rpcconnect":  "10.0.0.1",
+		"rpcuser":     "alice",
+		"rpcpassword": "testsecret",
+	}, opts)
+
+	opts, err = ReadBitcoinConf(strings.NewReader(testBitcoinConf), BitcoinSignet)
+	require.NoError(t, err)
+	assert.Equal(t, "39332", opts["rpcport"])
+
+	_, err = ReadBitcoinConf(strings.NewReader("rpcuser\n"), BitcoinMainnet)
+	assert.Error(t, err)
+}
+
+func TestBitcoindConnConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gots-bitcoin")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, "bitcoin.conf"), []byte(testBitcoinConf), 0600,
+	))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "regtest"), 0700))
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, "regtest", "other.cookie"),
+		[]byte("__cookie__:c00k1e\n"), 0600,
+	))
+
+	cfg, err := BitcoindConnConfig(dir, BitcoinMainnet)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:9332", cfg.Host)
+	assert.Equal(t, "alice", cfg.User)
+	assert.Equal(t, "secret", cfg.Pass)
+	assert.True(t, cfg.HTTPPostMode)
+
+	cfg, err = BitcoindConnConfig(dir, BitcoinTestnet)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:18332", cfg.Host)
+	assert.Equal(t, "testsecret", cfg.Pass)
+
+	cfg, err = BitcoindConnConfig(dir, BitcoinRegtest)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:18443", cfg.Host)
+	assert.Equal(t, "__cookie__", cfg.User)
+	assert.Equal(t, "c00k1e", cfg.Pass)
+
+	cfg, err = BitcoindConnConfig(dir, BitcoinSignet)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:39332", cfg.Host)
+	assert.Equal(t, "secret", cfg.Pass)
+
+	// without bitcoin.conf, the default cookie is used
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, os.MkdirAll(filepath.Join(empty, "signet"), 0700))
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(empty, "signet", ".cookie"),
+		[]byte("__cookie__:s1gnet"), 0600,
+	))
+	cfg, err = BitcoindConnConfig(empty, BitcoinSignet)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:38332", cfg.Host)
+	assert.Equal(t, "s1gnet", cfg.Pass)
+	_, err = BitcoindConnConfig(empty, BitcoinRegtest)
+	assert.Error(t, err)
+}
+
+func TestParseBitcoinNodeURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gots-bitcoin")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, ".cookie"), []byte("__cookie__:abc"), 0600,
+	))
+
+	cfg, err := ParseBitcoinNodeURL(
+		"https://bob:pw@node.example.org:8443", dir, BitcoinMainnet,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "node.example.org:8443", cfg.Host)
+	assert.Equal(t, "bob", cfg.User)
+	assert.Equal(t, "pw", cfg.Pass)
+	assert.False(t, cfg.DisableTLS)
+
+	cfg, err = ParseBitcoinNodeURL("http://localhost", dir, BitcoinMainnet)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:8332", cfg.Host)
+	assert.Equal(t, "__cookie__", cfg.User)
+	assert.Equal(t, "abc", cfg.Pass)
+	assert.True(t, cfg.DisableTLS)
+
+	_, err = ParseBitcoinNodeURL("ftp://localhost", dir, BitcoinMainnet)
+	assert.Error(t, err)
+	_, err = ParseBitcoinNodeURL("http://localhost/wallet/x", dir, BitcoinMainnet)
+	assert.Error(t, err)
+}
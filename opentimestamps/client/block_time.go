@@ -0,0 +1,80 @@
+package client
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// medianTimeBlocks is the number of previous blocks used for the median
+	// time past, as in bitcoin's consensus rules.
+	medianTimeBlocks = 11
+	// defaultNextBlocks is the number of following blocks whose times are
+	// considered by default.
+	defaultNextBlocks = 6
+)
+
+// A TimeInterval bounds the time an attested block was created. The
+// attested message existed no later than Latest.
+//
+// Header times are not exact: bitcoin only requires them to be later than
+// the median time past of the previous blocks, and not too far in the
+// future. Latest is the maximum header time of the block and the blocks
+// following it, so it holds as long as one of these blocks was mined with a
+// truthful time.
+type TimeInterval struct {
+	Earliest time.Time
+	Latest   time.Time
+}
+
+func (i TimeInterval) String() string {
+	return i.Earliest.Format(time.RFC3339) + " - " + i.Latest.Format(time.RFC3339)
+}
+
+// medianTime returns the median of the given times, using the same index as
+// bitcoin's median time past.
+func medianTime(times []time.Time) time.Time {
+	sorted := append([]time.Time{}, times...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Before(sorted[j])
+	})
+	return sorted[len(sorted)/2]
+}
+
+// blockTimes adds the median time past and the maximum time of up to
+// nextBlocks following blocks to the block at the given height.
+func blockTimes(
+	s BlockHeaderSource, height uint64, block *BitcoinBlock, nextBlocks int,
+) error {
+	var prevTimes []time.Time
+	for i := uint64(1); i <= medianTimeBlocks && i <= height; i++ {
+		h, err := getBlockHeader(s, height-i)
+		if err != nil {
+			return err
+		}
+		prevTimes = append(prevTimes, h.Timestamp)
+	}
+	if len(prevTimes) > 0 {
+		block.MedianTimePast = medianTime(prevTimes).UTC()
+	}
+
+	for i := 1; i <= nextBlocks; i++ {
+		if block.Confirmations > 0 && int64(i) >= block.Confirmations {
+			break
+		}
+		h, err := getBlockHeader(s, height+uint64(i))
+		if err != nil {
+			if block.Confirmations > 0 {
+				return err
+			}
+			// without a best height, the end of the chain is only
+			// noticed by the failed lookup
+			break
+		}
+		if block.MaxNextTime == nil || h.Timestamp.After(*block.MaxNextTime) {
+			t := h.Timestamp.UTC()
+			block.MaxNextTime = &t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// defaultBulkWorkers is the number of proofs verified concurrently if
+// BulkOptions.Workers is not set.
+const defaultBulkWorkers = 8
+
+// A ReportStatus is the overall outcome of a Report.
+type ReportStatus int
+
+const (
+	// StatusFailed means no attestation was verified and the timestamp
+	// isn't pending either.
+	StatusFailed ReportStatus = iota
+	// StatusPending means the timestamp only has pending attestations.
+	StatusPending
+	// StatusVerified means at least one attestation was verified.
+	StatusVerified
+)
+
+func (s ReportStatus) String() string {
+	switch s {
+	case StatusPending:
+		return "pending"
+	case StatusVerified:
+		return "verified"
+	}
+	return "failed"
+}
+
+// Status returns StatusVerified if an attestation was verified. Otherwise,
+// it returns StatusPending if there are pending attestations and no
+// verification failed, and StatusFailed if there aren't.
+func (r *Report) Status() ReportStatus {
+	if r.Time() != nil {
+		return StatusVerified
+	}
+	if r.Err() != nil {
+		return StatusFailed
+	}
+	for _, res := range r.Results {
+		if _, ok := opentimestamps.PendingURI(res.Attestation); ok {
+			return StatusPending
+		}
+	}
+	return StatusFailed
+}
+
+// A BulkSummary counts the outcomes of many reports.
+type BulkSummary struct {
+	Verified int
+	Pending  int
+	Failed   int
+}
+
+// Add counts a report with the given status.
+func (s *BulkSummary) Add(status ReportStatus) {
+	switch status {
+	case StatusVerified:
+		s.Verified += 1
+	case StatusPending:
+		s.Pending += 1
+	default:
+		s.Failed += 1
+	}
+}
+
+// Total returns the number of counted reports.
+func (s *BulkSummary) Total() int {
+	return s.Verified + s.Pending + s.Failed
+}
+
+func (s BulkSummary) String() string {
+	return fmt.Sprintf(
+		"%d verified, %d pending, %d failed", s.Verified, s.Pending, s.Failed,
+	)
+}
+
+// BulkOptions configure the verification of many proofs.
+type BulkOptions struct {
+	// Workers is the number of proofs verified concurrently.
+	Workers int
+	// Progress is called after each proof with the index of the proof, its
+	// report and the number of proofs done so far. Calls are serialized.
+	Progress func(i int, r *Report, done, total int)
+}
+
+// BulkReportFunc creates the reports of n proofs on a pool of workers,
+// calling report with the index of each proof. The reports are only passed
+// to opts.Progress, so proofs can be loaded by report and dropped once
+// handled, instead of keeping all of them in memory.
+func BulkReportFunc(
+	n int, report func(i int) *Report, opts BulkOptions,
+) BulkSummary {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultBulkWorkers
+	}
+	var summary BulkSummary
+	var mu sync.Mutex
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := report(i)
+				mu.Lock()
+				summary.Add(r.Status())
+				if opts.Progress != nil {
+					opts.Progress(i, r, summary.Total(), n)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return summary
+}
+
+// BulkReport creates the reports of many timestamps concurrently. The
+// reports are in the same order as the timestamps. The registered verifiers
+// must be safe for concurrent use; wrap their header sources in a
+// SharedSource to look up each block only once.
+func (m *MultiVerifier) BulkReport(
+	timestamps []*opentimestamps.Timestamp, opts BulkOptions,
+) ([]*Report, BulkSummary) {
+	reports := make([]*Report, len(timestamps))
+	summary := BulkReportFunc(len(timestamps), func(i int) *Report {
+		reports[i] = m.Report(timestamps[i])
+		return reports[i]
+	}, opts)
+	return reports, summary
+}
+
+// BulkReportDetached is like BulkReport for detached timestamps.
+func (m *MultiVerifier) BulkReportDetached(
+	proofs []*opentimestamps.DetachedTimestamp, opts BulkOptions,
+) ([]*Report, BulkSummary) {
+	reports := make([]*Report, len(proofs))
+	summary := BulkReportFunc(len(proofs), func(i int) *Report {
+		reports[i] = m.ReportDetached(proofs[i])
+		return reports[i]
+	}, opts)
+	return reports, summary
+}
+
+// rateLimiter spaces out requests by a minimum interval
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until the next request may be made.
+func (l *rateLimiter) wait() {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	t := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	time.Sleep(time.Until(t))
+}
+
+// sharedCall is a lookup of a SharedSource, in flight or done
+type sharedCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+type (
+	blockCountKey struct{}
+	blockHashKey  int64
+	headerKey     chainhash.Hash
+)
+
+// A SharedSource is a ChainSource for bulk verification. Each block hash,
+// header and the block count are looked up from the underlying source only
+// once, even by concurrent callers, and requests are limited to a maximum
+// rate. Failed lookups are retried by the next caller.
+//
+// Since results are kept, a SharedSource should only be used for one bulk
+// verification: it doesn't notice new blocks or reorgs.
+type SharedSource struct {
+	source  ChainSource
+	limiter *rateLimiter
+
+	mu    sync.Mutex
+	calls map[interface{}]*sharedCall
+}
+
+// NewSharedSource wraps a source, limiting requests to maxRate per second.
+// A maxRate of zero disables the limit.
+func NewSharedSource(source ChainSource, maxRate float64) *SharedSource {
+	s := &SharedSource{
+		source: source,
+		calls:  map[interface{}]*sharedCall{},
+	}
+	if maxRate > 0 {
+		s.limiter = &rateLimiter{
+			interval: time.Duration(float64(time.Second) / maxRate),
+		}
+	}
+	return s
+}
+
+// do returns the result of the call for key, calling f if there is none.
+func (s *SharedSource) do(
+	key interface{}, f func() (interface{}, error),
+) (interface{}, error) {
+	s.mu.Lock()
+	if c, ok := s.calls[key]; ok {
+		s.mu.Unlock()
+		<-c.done
+		return c.value, c.err
+	}
+	c := &sharedCall{done: make(chan struct{})}
+	s.calls[key] = c
+	s.mu.Unlock()
+
+	if s.limiter != nil {
+		s.limiter.wait()
+	}
+	c.value, c.err = f()
+	if c.err != nil {
+		s.mu.Lock()
+		delete(s.calls, key)
+		s.mu.Unlock()
+	}
+	close(c.done)
+	return c.value, c.err
+}
+
+func (s *SharedSource) unwrapSource() BlockHeaderSource {
+	return s.source
+}
+
+// GetBlockCount returns the best height of the underlying source at the
+// first call.
+func (s *SharedSource) GetBlockCount() (int64, error) {
+	v, err := s.do(blockCountKey{}, func() (interface{}, error) {
+		return s.source.GetBlockCount()
+	})
+	if err != nil {
+		return 0, err
+	}
+	return v.(int64), nil
+}
+
+// GetBlockHash returns the hash of the block at the given height.
+func (s *SharedSource) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	v, err := s.do(blockHashKey(height), func() (interface{}, error) {
+		return s.source.GetBlockHash(height)
+	})
+	if err != nil {
+		return nil, err
+	}
+	hash := *v.(*chainhash.Hash)
+	return &hash, nil
+}
+
+// GetBlockHeader returns the header of the block with the given hash.
+func (s *SharedSource) GetBlockHeader(
+	hash *chainhash.Hash,
+) (*wire.BlockHeader, error) {
+	v, err := s.do(headerKey(*hash), func() (interface{}, error) {
+		return s.source.GetBlockHeader(hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	header := *v.(*wire.BlockHeader)
+	return &header, nil
+}
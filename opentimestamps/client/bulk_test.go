@@ -0,0 +1,134 @@
+package client
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBulkTestTimestamps returns n timestamps. Every third one is pending,
+// the others are anchored in blocks 100 to 104 of the returned source, whose
+// merkle roots match the messages 0 to 4.
+func newBulkTestTimestamps(
+	t *testing.T, n int,
+) ([]*opentimestamps.Timestamp, *countingSource) {
+	source := newCountingSource(0)
+	var timestamps []*opentimestamps.Timestamp
+	for i := 0; i < n; i++ {
+		message := []byte{byte(i)}
+		height := byte(100 + i%5)
+		if i < 5 {
+			digest := sha256.Sum256(message)
+			source.add(int64(height), &wire.BlockHeader{
+				MerkleRoot: chainhash.Hash(digest),
+			})
+		}
+		if i%3 == 2 {
+			timestamps = append(timestamps, newForkedTimestamp(
+				t, message, rawPendingAttestation(t, calendarA),
+			))
+			continue
+		}
+		timestamps = append(
+			timestamps, newAttestedTimestamp(t, message, bitcoinTag, height),
+		)
+	}
+	source.fill(110)
+	return timestamps, source
+}
+
+func TestReportStatus(t *testing.T) {
+	timestamps, source := newBulkTestTimestamps(t, 7)
+	multi, err := NewMultiVerifier(NewBitcoinAttestationVerifier(source))
+	require.NoError(t, err)
+
+	assert.Equal(t, StatusVerified, multi.Report(timestamps[0]).Status())
+	assert.Equal(t, StatusPending, multi.Report(timestamps[2]).Status())
+	assert.Equal(t, StatusFailed, multi.Report(timestamps[6]).Status())
+	assert.Equal(t, StatusFailed, (&Report{}).Status())
+	assert.Equal(t, "pending", StatusPending.String())
+}
+
+func TestBulkReport(t *testing.T) {
+	timestamps, source := newBulkTestTimestamps(t, 60)
+	shared := NewSharedSource(source, 0)
+	multi, err := NewMultiVerifier(NewBitcoinAttestationVerifier(shared))
+	require.NoError(t, err)
+
+	var done []int
+	reports, summary := multi.BulkReport(timestamps, BulkOptions{
+		Workers: 4,
+		Progress: func(i int, r *Report, n, total int) {
+			assert.Equal(t, 60, total)
+			assert.True(t, i >= 0 && i < total)
+			assert.NotNil(t, r)
+			done = append(done, n)
+		},
+	})
+	require.Equal(t, 60, len(reports))
+	require.Equal(t, 60, len(done))
+	assert.Equal(t, 60, done[59])
+
+	// messages 0, 1, 3 and 4 verify, 2 is pending
+	assert.Equal(t, BulkSummary{Verified: 4, Pending: 20, Failed: 36}, summary)
+	assert.Equal(t, "4 verified, 20 pending, 36 failed", summary.String())
+	for i, r := range reports {
+		assert.Equal(t, multi.Report(timestamps[i]).Status(), r.Status())
+	}
+
+	// the hashes and headers of blocks 100 to 104 are looked up once
+	assert.Equal(t, 2*5, source.calls())
+}
+
+func TestBulkReportFunc(t *testing.T) {
+	timestamps, source := newBulkTestTimestamps(t, 12)
+	multi, err := NewMultiVerifier(NewBitcoinAttestationVerifier(source))
+	require.NoError(t, err)
+
+	statuses := make([]ReportStatus, len(timestamps))
+	summary := BulkReportFunc(len(timestamps), func(i int) *Report {
+		return multi.Report(timestamps[i])
+	}, BulkOptions{
+		Workers: 3,
+		Progress: func(i int, r *Report, done, total int) {
+			statuses[i] = r.Status()
+		},
+	})
+	assert.Equal(t, 12, summary.Total())
+	for i, status := range statuses {
+		assert.Equal(t, multi.Report(timestamps[i]).Status(), status)
+	}
+}
+
+func TestSharedSource(t *testing.T) {
+	source := newCountingSource(100)
+	shared := NewSharedSource(source, 1000)
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		for height := uint64(0); height < 10; height++ {
+			_, err := getBlockHeader(shared, height)
+			require.NoError(t, err)
+		}
+	}
+	// 20 lookups 1ms apart
+	assert.True(t, time.Since(start) >= 19*time.Millisecond)
+	assert.Equal(t, 20, source.calls())
+
+	// failures are not kept
+	_, err := shared.GetBlockHash(101)
+	assert.Error(t, err)
+	source.fill(101)
+	_, err = shared.GetBlockHash(101)
+	assert.NoError(t, err)
+
+	count, err := shared.GetBlockCount()
+	require.NoError(t, err)
+	assert.Equal(t, int64(101), count)
+}
@@ -0,0 +1,333 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// electrumProtocolVersion is the protocol version requested from
+	// Electrum servers. It is the first one with checkpoint proofs.
+	electrumProtocolVersion = "1.4"
+	// electrumTimeout limits each request to an Electrum server.
+	electrumTimeout = 30 * time.Second
+	// maxElectrumResponseSize limits the lines read from an Electrum server.
+	maxElectrumResponseSize = 1 << 20
+)
+
+// An ElectrumCheckpoint is a trusted merkle root of the hashes of all blocks
+// up to and including Height, as used by Electrum wallets.
+type ElectrumCheckpoint struct {
+	Height int64
+	Root   chainhash.Hash
+}
+
+// An ElectrumClient is a ChainSource using the JSON-RPC protocol of an
+// Electrum server.
+//
+// The proof of work of all headers is checked. If Checkpoint is set,
+// headers up to its height are proven against its merkle root, and headers
+// above it are rejected unless AllowUncheckpointed is set. Without a
+// checkpoint, headers are trusted to the server. Electrum servers can't
+// look up headers by hash, so GetBlockHeader only returns headers of the
+// last electrumHeaders blocks looked up with GetBlockHash.
+type ElectrumClient struct {
+	Checkpoint *ElectrumCheckpoint
+	// AllowUncheckpointed accepts headers above the checkpoint with only
+	// their proof of work checked.
+	AllowUncheckpointed bool
+	// Params are the parameters of the server's network, used to check the
+	// proof of work. They default to mainnet.
+	Params *chaincfg.Params
+
+	mu      sync.Mutex
+	conn    net.Conn
+	scanner *bufio.Scanner
+	id      uint64
+	headers map[chainhash.Hash]*wire.BlockHeader
+	// order holds the hashes in headers, oldest first
+	order []chainhash.Hash
+}
+
+// electrumHeaders is the number of headers an ElectrumClient keeps for
+// GetBlockHeader.
+const electrumHeaders = 64
+
+// DialElectrum connects to an Electrum server at the given address, like
+// "electrum.example.org:50002". If tlsConfig is nil, the connection is
+// not encrypted.
+func DialElectrum(addr string, tlsConfig *tls.Config) (*ElectrumClient, error) {
+	dialer := &net.Dialer{Timeout: electrumTimeout}
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewElectrumClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewElectrumClient negotiates the protocol version over an established
+// connection to an Electrum server.
+func NewElectrumClient(conn net.Conn) (*ElectrumClient, error) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, maxElectrumResponseSize)
+	c := &ElectrumClient{
+		conn:    conn,
+		scanner: scanner,
+		headers: map[chainhash.Hash]*wire.BlockHeader{},
+	}
+	var version []string
+	err := c.call(
+		"server.version", &version,
+		"go-opentimestamps", electrumProtocolVersion,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the connection to the server.
+func (c *ElectrumClient) Close() error {
+	return c.conn.Close()
+}
+
+type electrumRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+	ID      uint64        `json:"id"`
+}
+
+type electrumError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type electrumResponse struct {
+	// ID is nil for notifications
+	ID     *uint64         `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *electrumError  `json:"error"`
+}
+
+// call performs a JSON-RPC request and decodes the result into res.
+// Notifications received meanwhile are skipped.
+func (c *ElectrumClient) call(
+	method string, res interface{}, params ...interface{},
+) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id += 1
+	req, err := json.Marshal(electrumRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		ID:      c.id,
+	})
+	if err != nil {
+		return err
+	}
+	c.conn.SetDeadline(time.Now().Add(electrumTimeout))
+	if _, err := c.conn.Write(append(req, '\n')); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	for c.scanner.Scan() {
+		var resp electrumResponse
+		if err := json.Unmarshal(c.scanner.Bytes(), &resp); err != nil {
+			return fmt.Errorf("%s: %v", method, err)
+		}
+		if resp.ID == nil || *resp.ID != c.id {
+			continue
+		}
+		if resp.Error != nil {
+			return fmt.Errorf(
+				"%s: rpc error %d: %s",
+				method, resp.Error.Code, resp.Error.Message,
+			)
+		}
+		return json.Unmarshal(resp.Result, res)
+	}
+	if err := c.scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	return fmt.Errorf("%s: connection closed", method)
+}
+
+// parseElectrumHeader decodes a hex-encoded header.
+func parseElectrumHeader(s string) (*wire.BlockHeader, error) {
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %v", err)
+	}
+	if len(raw) != wire.MaxBlockHeaderPayload {
+		return nil, fmt.Errorf("invalid header size %d", len(raw))
+	}
+	h := &wire.BlockHeader{}
+	if err := h.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// GetBlockCount returns the height of the chain tip, using
+// blockchain.headers.subscribe.
+func (c *ElectrumClient) GetBlockCount() (int64, error) {
+	var tip struct {
+		Height int64 `json:"height"`
+	}
+	if err := c.call("blockchain.headers.subscribe", &tip); err != nil {
+		return 0, err
+	}
+	return tip.Height, nil
+}
+
+type electrumHeaderProof struct {
+	Header string   `json:"header"`
+	Root   string   `json:"root"`
+	Branch []string `json:"branch"`
+}
+
+// checkElectrumProof verifies that the block hash is the leaf at the given
+// height of the checkpoint's merkle tree.
+func checkElectrumProof(
+	cp *ElectrumCheckpoint, height int64, hash chainhash.Hash,
+	proof *electrumHeaderProof,
+) error {
+	if depth := bits.Len64(uint64(cp.Height)); len(proof.Branch) != depth {
+		return fmt.Errorf(
+			"merkle branch of length %d, expected %d",
+			len(proof.Branch), depth,
+		)
+	}
+	node := hash
+	index := height
+	for _, s := range proof.Branch {
+		sibling, err := chainhash.NewHashFromStr(s)
+		if err != nil {
+			return fmt.Errorf("invalid merkle branch: %v", err)
+		}
+		if index&1 == 1 {
+			node = chainhash.DoubleHashH(append(sibling[:], node[:]...))
+		} else {
+			node = chainhash.DoubleHashH(append(node[:], sibling[:]...))
+		}
+		index >>= 1
+	}
+	if node != cp.Root {
+		return fmt.Errorf("merkle root %v, expected %v", node, cp.Root)
+	}
+	return nil
+}
+
+// getHeader returns the header at the given height, using
+// blockchain.block.header, and proves it against the checkpoint.
+func (c *ElectrumClient) getHeader(height int64) (*wire.BlockHeader, error) {
+	params := c.Params
+	if params == nil {
+		params = &chaincfg.MainNetParams
+	}
+	cp := c.Checkpoint
+	if cp != nil && height > cp.Height && !c.AllowUncheckpointed {
+		return nil, fmt.Errorf(
+			"header at height %d above checkpoint at %d", height, cp.Height,
+		)
+	}
+	if cp == nil || height > cp.Height {
+		var s string
+		if err := c.call("blockchain.block.header", &s, height); err != nil {
+			return nil, err
+		}
+		h, err := parseElectrumHeader(s)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkProofOfWork(h, params); err != nil {
+			return nil, fmt.Errorf("header at height %d: %v", height, err)
+		}
+		return h, nil
+	}
+
+	var proof electrumHeaderProof
+	err := c.call("blockchain.block.header", &proof, height, cp.Height)
+	if err != nil {
+		return nil, err
+	}
+	h, err := parseElectrumHeader(proof.Header)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkProofOfWork(h, params); err != nil {
+		return nil, fmt.Errorf("header at height %d: %v", height, err)
+	}
+	err = checkElectrumProof(cp, height, h.BlockHash(), &proof)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"header at height %d not in checkpoint: %v", height, err,
+		)
+	}
+	return h, nil
+}
+
+// GetBlockHash returns the hash of the block at the given height.
+func (c *ElectrumClient) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	h, err := c.getHeader(height)
+	if err != nil {
+		return nil, err
+	}
+	hash := h.BlockHash()
+	c.mu.Lock()
+	c.addHeader(hash, h)
+	c.mu.Unlock()
+	return &hash, nil
+}
+
+// addHeader keeps a header for GetBlockHeader, dropping the oldest one if
+// there are too many. c.mu must be held.
+func (c *ElectrumClient) addHeader(hash chainhash.Hash, h *wire.BlockHeader) {
+	if _, ok := c.headers[hash]; !ok {
+		c.order = append(c.order, hash)
+	}
+	c.headers[hash] = h
+	if len(c.order) > electrumHeaders {
+		delete(c.headers, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// GetBlockHeader returns the header of a block recently looked up with
+// GetBlockHash.
+func (c *ElectrumClient) GetBlockHeader(
+	hash *chainhash.Hash,
+) (*wire.BlockHeader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.headers[*hash]
+	if !ok {
+		return nil, fmt.Errorf("block %v not looked up by height", hash)
+	}
+	header := *h
+	return &header, nil
+}
@@ -0,0 +1,283 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// electrumMerkle returns the merkle root of the hashes and the branch of
+// the leaf at index, as computed by Electrum servers.
+func electrumMerkle(
+	hashes []chainhash.Hash, index int,
+) (chainhash.Hash, []chainhash.Hash) {
+	var branch []chainhash.Hash
+	level := append([]chainhash.Hash{}, hashes...)
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, level[index^1])
+		var next []chainhash.Hash
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, chainhash.DoubleHashH(
+				append(level[i][:], level[i+1][:]...),
+			))
+		}
+		level = next
+		index >>= 1
+	}
+	return level[0], branch
+}
+
+// fakeElectrum serves the blocks of a fakeHeaderSource like an Electrum
+// server. If badBranch is set, merkle branches are corrupted.
+type fakeElectrum struct {
+	source    *fakeHeaderSource
+	badBranch bool
+}
+
+func (f *fakeElectrum) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go f.serveConn(conn)
+	}
+}
+
+func (f *fakeElectrum) header(height int64) (string, chainhash.Hash, error) {
+	hash, err := f.source.GetBlockHash(height)
+	if err != nil {
+		return "", chainhash.Hash{}, err
+	}
+	buf := &bytes.Buffer{}
+	f.source.headers[*hash].Serialize(buf)
+	return hex.EncodeToString(buf.Bytes()), *hash, nil
+}
+
+func (f *fakeElectrum) handle(
+	method string, params []int64,
+) (interface{}, error) {
+	switch method {
+	case "server.version":
+		return []string{"fake 1.0", "1.4"}, nil
+	case "blockchain.headers.subscribe":
+		height, _ := f.source.GetBlockCount()
+		h, _, err := f.header(height)
+		return map[string]interface{}{"height": height, "hex": h}, err
+	case "blockchain.block.header":
+		h, _, err := f.header(params[0])
+		if err != nil || len(params) == 1 || params[1] == 0 {
+			return h, err
+		}
+		var hashes []chainhash.Hash
+		for height := int64(0); height <= params[1]; height++ {
+			_, hash, err := f.header(height)
+			if err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, hash)
+		}
+		root, branch := electrumMerkle(hashes, int(params[0]))
+		var branchHex []string
+		for _, hash := range branch {
+			branchHex = append(branchHex, hash.String())
+		}
+		if f.badBranch {
+			branchHex[0] = chainhash.Hash{1}.String()
+		}
+		return map[string]interface{}{
+			"header": h, "root": root.String(), "branch": branchHex,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown method %s", method)
+}
+
+func (f *fakeElectrum) serveConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req struct {
+			ID     uint64        `json:"id"`
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return
+		}
+		var heights []int64
+		for _, p := range req.Params {
+			if n, ok := p.(float64); ok {
+				heights = append(heights, int64(n))
+			}
+		}
+		if req.Method == "blockchain.headers.subscribe" {
+			// notifications are skipped by the client
+			enc.Encode(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"method":  req.Method,
+				"params":  []interface{}{},
+			})
+		}
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		res, err := f.handle(req.Method, heights)
+		if err != nil {
+			resp["error"] = map[string]interface{}{
+				"code": 1, "message": err.Error(),
+			}
+		} else {
+			resp["result"] = res
+		}
+		enc.Encode(resp)
+	}
+}
+
+// newFakeElectrumChain returns a regtest chain of 120 blocks with the
+// digest as merkle root of block 100
+func newFakeElectrumChain(digest [32]byte) *fakeHeaderSource {
+	source := newFakeHeaderSource()
+	genesis := &chaincfg.RegressionNetParams.GenesisBlock.Header
+	source.add(0, genesis)
+	headers := mineChain(
+		genesis, 0, 120, map[int64]chainhash.Hash{100: chainhash.Hash(digest)},
+	)
+	for i, h := range headers {
+		source.add(int64(i+1), h)
+	}
+	return source
+}
+
+func TestElectrumClient(t *testing.T) {
+	message := []byte("hello electrum")
+	digest := sha256.Sum256(message)
+	source := newFakeElectrumChain(digest)
+	server := &fakeElectrum{source: source}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go server.serve(l)
+
+	electrum, err := DialElectrum(l.Addr().String(), nil)
+	require.NoError(t, err)
+	defer electrum.Close()
+
+	var hashes []chainhash.Hash
+	for height := int64(0); height <= 110; height++ {
+		hash, _ := source.GetBlockHash(height)
+		hashes = append(hashes, *hash)
+	}
+	root, _ := electrumMerkle(hashes, 0)
+	electrum.Checkpoint = &ElectrumCheckpoint{Height: 110, Root: root}
+	electrum.Params = &chaincfg.RegressionNetParams
+
+	count, err := electrum.GetBlockCount()
+	require.NoError(t, err)
+	assert.Equal(t, int64(120), count)
+
+	verifier := NewBitcoinAttestationVerifier(electrum)
+	verifier.MinConfirmations = 6
+	results := verifier.BitcoinVerifications(
+		newAttestedTimestamp(t, message, bitcoinTag, 100),
+	)
+	require.Equal(t, 1, len(results))
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, int64(21), results[0].Confirmations)
+
+	// above the checkpoint, headers are rejected unless allowed
+	_, err = electrum.GetBlockHash(115)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "above checkpoint")
+	electrum.AllowUncheckpointed = true
+	_, err = electrum.GetBlockHash(115)
+	assert.NoError(t, err)
+	_, err = electrum.GetBlockHash(121)
+	assert.Error(t, err)
+
+	// the proof of work is checked against the network's limit
+	electrum.Params = &chaincfg.MainNetParams
+	_, err = electrum.GetBlockHash(116)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "out of range")
+	electrum.Params = &chaincfg.RegressionNetParams
+	_, err = electrum.GetBlockHeader(&chainhash.Hash{})
+	assert.Error(t, err)
+
+	// only the headers of the last lookups are kept
+	electrum.AllowUncheckpointed = false
+	first, err := electrum.GetBlockHash(0)
+	require.NoError(t, err)
+	for height := int64(1); height <= 110; height++ {
+		_, err = electrum.GetBlockHash(height)
+		require.NoError(t, err)
+		_, err = electrum.GetBlockHash(height)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, electrumHeaders, len(electrum.headers))
+	_, err = electrum.GetBlockHeader(first)
+	assert.Error(t, err)
+	last, _ := source.GetBlockHash(110)
+	_, err = electrum.GetBlockHeader(last)
+	assert.NoError(t, err)
+
+	// a wrong checkpoint
+	electrum.Checkpoint = &ElectrumCheckpoint{Height: 110}
+	_, err = electrum.GetBlockHash(100)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not in checkpoint")
+}
+
+func TestElectrumClientBadBranch(t *testing.T) {
+	source := newFakeElectrumChain(sha256.Sum256([]byte("hello")))
+	server := &fakeElectrum{source: source, badBranch: true}
+
+	// serve over TLS with the test certificate of httptest
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.StartTLS()
+	defer ts.Close()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", ts.TLS)
+	require.NoError(t, err)
+	defer l.Close()
+	go server.serve(l)
+
+	clientConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig
+	electrum, err := DialElectrum(l.Addr().String(), clientConfig)
+	require.NoError(t, err)
+	defer electrum.Close()
+
+	var hashes []chainhash.Hash
+	for height := int64(0); height <= 110; height++ {
+		hash, _ := source.GetBlockHash(height)
+		hashes = append(hashes, *hash)
+	}
+	root, _ := electrumMerkle(hashes, 0)
+	electrum.Checkpoint = &ElectrumCheckpoint{Height: 110, Root: root}
+	electrum.Params = &chaincfg.RegressionNetParams
+	_, err = electrum.GetBlockHash(100)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "merkle root")
+
+	// without a checkpoint, the header is trusted
+	electrum.Checkpoint = nil
+	_, err = electrum.GetBlockHash(100)
+	assert.NoError(t, err)
+
+	// untrusted certificates are rejected
+	_, err = DialElectrum(l.Addr().String(), &tls.Config{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,186 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/go-socks/socks"
+)
+
+// maxEsploraResponseSize limits the responses read from an Esplora server.
+// The largest expected response is a hex-encoded header.
+const maxEsploraResponseSize = 1024
+
+// An EsploraClient is a ChainSource using the REST API of an Esplora block
+// explorer, like https://blockstream.info/api.
+type EsploraClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewEsploraClient returns a client for the API at baseURL.
+func NewEsploraClient(baseURL string) *EsploraClient {
+	return &EsploraClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  http.DefaultClient,
+	}
+}
+
+// SetProxy makes the client connect through a SOCKS5 proxy.
+func (e *EsploraClient) SetProxy(proxy *socks.Proxy) {
+	e.client = opentimestamps.NewSOCKS5Client(proxy)
+}
+
+// get returns the trimmed response body for the path.
+func (e *EsploraClient) get(path string) (string, error) {
+	url := e.baseURL + path
+	resp, err := e.client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(
+		io.LimitReader(resp.Body, maxEsploraResponseSize+1),
+	)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(
+			"GET %s: unexpected response %q: %q",
+			url, resp.Status, bytes.TrimSpace(body),
+		)
+	}
+	if len(body) > maxEsploraResponseSize {
+		return "", fmt.Errorf("GET %s: response too large", url)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// GetBlockCount returns the height of the chain tip.
+func (e *EsploraClient) GetBlockCount() (int64, error) {
+	s, err := e.get("/blocks/tip/height")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// GetBlockHash returns the hash of the block at the given height.
+func (e *EsploraClient) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	s, err := e.get(fmt.Sprintf("/block-height/%d", height))
+	if err != nil {
+		return nil, err
+	}
+	return chainhash.NewHashFromStr(s)
+}
+
+// GetBlockHeader returns the header of the block with the given hash. It
+// returns an error if the header doesn't hash to the requested block hash.
+func (e *EsploraClient) GetBlockHeader(
+	hash *chainhash.Hash,
+) (*wire.BlockHeader, error) {
+	s, err := e.get("/block/" + hash.String() + "/header")
+	if err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header for block %v: %v", hash, err)
+	}
+	if len(raw) != wire.MaxBlockHeaderPayload {
+		return nil, fmt.Errorf(
+			"invalid header size %d for block %v", len(raw), hash,
+		)
+	}
+	h := &wire.BlockHeader{}
+	if err := h.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	if actual := h.BlockHash(); !actual.IsEqual(hash) {
+		return nil, fmt.Errorf(
+			"header for block %v hashes to %v", hash, actual,
+		)
+	}
+	return h, nil
+}
+
+// A CrossCheckedSource is a ChainSource that queries several sources and
+// fails if they disagree about the blocks.
+type CrossCheckedSource struct {
+	sources []ChainSource
+}
+
+// NewCrossCheckedSource returns a source that checks the block hashes of
+// all given sources against each other. At least one source is required.
+func NewCrossCheckedSource(
+	sources ...ChainSource,
+) (*CrossCheckedSource, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no sources")
+	}
+	return &CrossCheckedSource{sources}, nil
+}
+
+// GetBlockCount returns the lowest best height of all sources, so
+// confirmations are never overestimated.
+func (c *CrossCheckedSource) GetBlockCount() (int64, error) {
+	var min int64
+	for i, s := range c.sources {
+		count, err := s.GetBlockCount()
+		if err != nil {
+			return 0, err
+		}
+		if i == 0 || count < min {
+			min = count
+		}
+	}
+	return min, nil
+}
+
+// GetBlockHash returns the block hash at the given height if all sources
+// agree on it.
+func (c *CrossCheckedSource) GetBlockHash(
+	height int64,
+) (*chainhash.Hash, error) {
+	var hash *chainhash.Hash
+	for i, s := range c.sources {
+		h, err := s.GetBlockHash(height)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && !h.IsEqual(hash) {
+			return nil, fmt.Errorf(
+				"sources disagree on block %d: %v != %v", height, hash, h,
+			)
+		}
+		hash = h
+	}
+	return hash, nil
+}
+
+// GetBlockHeader returns the header from the first source. Since the header
+// must hash to the block hash the sources agreed on, it is not cross-checked.
+func (c *CrossCheckedSource) GetBlockHeader(
+	hash *chainhash.Hash,
+) (*wire.BlockHeader, error) {
+	h, err := c.sources[0].GetBlockHeader(hash)
+	if err != nil {
+		return nil, err
+	}
+	if actual := h.BlockHash(); !actual.IsEqual(hash) {
+		return nil, fmt.Errorf(
+			"header for block %v hashes to %v", hash, actual,
+		)
+	}
+	return h, nil
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps/internal/socks5test"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/go-socks/socks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeEsplora serves the blocks of a fakeHeaderSource like an Esplora
+// server. Headers listed in corrupt are served with a different nonce.
+func newFakeEsplora(
+	s *fakeHeaderSource, corrupt map[chainhash.Hash]bool,
+) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/blocks/tip/height":
+				count, _ := s.GetBlockCount()
+				fmt.Fprintf(w, "%d", count)
+			case strings.HasPrefix(r.URL.Path, "/block-height/"):
+				height, err := strconv.ParseInt(
+					strings.TrimPrefix(r.URL.Path, "/block-height/"), 10, 64,
+				)
+				if err != nil {
+					http.Error(w, "Invalid height", http.StatusBadRequest)
+					return
+				}
+				hash, err := s.GetBlockHash(height)
+				if err != nil {
+					http.Error(w, "Block not found", http.StatusNotFound)
+					return
+				}
+				fmt.Fprint(w, hash.String())
+			case strings.HasSuffix(r.URL.Path, "/header"):
+				hash, err := chainhash.NewHashFromStr(strings.TrimSuffix(
+					strings.TrimPrefix(r.URL.Path, "/block/"), "/header",
+				))
+				if err != nil {
+					http.Error(w, "Invalid hash", http.StatusBadRequest)
+					return
+				}
+				h, err := s.GetBlockHeader(hash)
+				if err != nil {
+					http.Error(w, "Block not found", http.StatusNotFound)
+					return
+				}
+				header := *h
+				if corrupt[*hash] {
+					header.Nonce += 1
+				}
+				buf := &bytes.Buffer{}
+				header.Serialize(buf)
+				fmt.Fprint(w, hex.EncodeToString(buf.Bytes()))
+			default:
+				http.NotFound(w, r)
+			}
+		},
+	))
+}
+
+func TestEsploraClient(t *testing.T) {
+	message := []byte("hello esplora")
+	digest := sha256.Sum256(message)
+	blockTime := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	source := newFakeHeaderSource()
+	header := &wire.BlockHeader{
+		MerkleRoot: chainhash.Hash(digest),
+		Timestamp:  blockTime,
+	}
+	source.add(100, header)
+	source.fill(110)
+	server := newFakeEsplora(source, nil)
+	defer server.Close()
+
+	esplora := NewEsploraClient(server.URL + "/")
+	count, err := esplora.GetBlockCount()
+	require.NoError(t, err)
+	assert.Equal(t, int64(110), count)
+
+	verifier := NewBitcoinAttestationVerifier(esplora)
+	verifier.MinConfirmations = 6
+	results := verifier.BitcoinVerifications(
+		newAttestedTimestamp(t, message, bitcoinTag, 100),
+	)
+	require.Equal(t, 1, len(results))
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, blockTime, *results[0].AttestationTime)
+	assert.Equal(t, int64(11), results[0].Confirmations)
+
+	_, err = esplora.GetBlockHash(111)
+	assert.Error(t, err)
+	_, err = esplora.GetBlockHeader(&chainhash.Hash{})
+	assert.Error(t, err)
+}
+
+func TestEsploraClientHeaderMismatch(t *testing.T) {
+	source := newFakeHeaderSource()
+	source.fill(10)
+	hash, err := source.GetBlockHash(5)
+	require.NoError(t, err)
+	server := newFakeEsplora(source, map[chainhash.Hash]bool{*hash: true})
+	defer server.Close()
+
+	esplora := NewEsploraClient(server.URL)
+	_, err = esplora.GetBlockHeader(hash)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "hashes to")
+
+	hash, err = source.GetBlockHash(6)
+	require.NoError(t, err)
+	_, err = esplora.GetBlockHeader(hash)
+	assert.NoError(t, err)
+}
+
+func TestCrossCheckedSource(t *testing.T) {
+	a := newFakeHeaderSource()
+	a.fill(10)
+	serverA := newFakeEsplora(a, nil)
+	defer serverA.Close()
+
+	// b agrees with a up to height 7 and is one block shorter
+	b := newFakeHeaderSource()
+	for height := int64(0); height <= 7; height++ {
+		hash, _ := a.GetBlockHash(height)
+		b.add(height, a.headers[*hash])
+	}
+	b.add(8, &wire.BlockHeader{Nonce: 1000})
+	b.add(9, &wire.BlockHeader{Nonce: 1001})
+	serverB := newFakeEsplora(b, nil)
+	defer serverB.Close()
+
+	source, err := NewCrossCheckedSource(
+		NewEsploraClient(serverA.URL), NewEsploraClient(serverB.URL),
+	)
+	require.NoError(t, err)
+
+	count, err := source.GetBlockCount()
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), count)
+
+	_, err = getBlockHeader(source, 7)
+	assert.NoError(t, err)
+	_, err = getBlockHeader(source, 8)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disagree")
+	_, err = getBlockHeader(source, 10)
+	assert.Error(t, err)
+
+	_, err = NewCrossCheckedSource()
+	assert.Error(t, err)
+}
+
+func TestEsploraClientProxy(t *testing.T) {
+	source := newFakeHeaderSource()
+	source.fill(110)
+	server := newFakeEsplora(source, nil)
+	defer server.Close()
+	proxy, err := socks5test.NewServer("", "")
+	require.NoError(t, err)
+	defer proxy.Close()
+
+	esplora := NewEsploraClient(server.URL)
+	esplora.SetProxy(&socks.Proxy{Addr: proxy.Addr()})
+	count, err := esplora.GetBlockCount()
+	require.NoError(t, err)
+	assert.Equal(t, int64(110), count)
+	assert.Equal(t, []string{server.Listener.Addr().String()}, proxy.Targets())
+}
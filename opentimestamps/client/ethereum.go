@@ -0,0 +1,258 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+	"github.com/btcsuite/go-socks/socks"
+)
+
+// An EthereumHeader contains the fields of an ethereum block header that are
+// needed to verify an EthereumAttestation.
+type EthereumHeader struct {
+	Number           uint64
+	Hash             []byte
+	TransactionsRoot []byte
+	Timestamp        time.Time
+}
+
+// An EthereumHeaderSource looks up ethereum block headers by number.
+type EthereumHeaderSource interface {
+	HeaderByNumber(number uint64) (*EthereumHeader, error)
+}
+
+// An EthereumBlockNumberSource reports the number of the most recent block.
+type EthereumBlockNumberSource interface {
+	BlockNumber() (uint64, error)
+}
+
+// An EthereumRPCClient is an EthereumHeaderSource using the JSON-RPC API of
+// an ethereum node.
+type EthereumRPCClient struct {
+	url    string
+	client *http.Client
+	id     uint64
+}
+
+func NewEthereumRPCClient(url string) *EthereumRPCClient {
+	return &EthereumRPCClient{url: url, client: http.DefaultClient}
+}
+
+// SetProxy makes the client connect through a SOCKS5 proxy.
+func (c *EthereumRPCClient) SetProxy(proxy *socks.Proxy) {
+	c.client = opentimestamps.NewSOCKS5Client(proxy)
+}
+
+type ethereumRPCRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+	ID      uint64        `json:"id"`
+}
+
+type ethereumRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type ethereumRPCResponse struct {
+	Result json.RawMessage   `json:"result"`
+	Error  *ethereumRPCError `json:"error"`
+}
+
+// call performs a JSON-RPC request and decodes the result into res.
+func (c *EthereumRPCClient) call(
+	method string, res interface{}, params ...interface{},
+) error {
+	body, err := json.Marshal(ethereumRPCRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		ID:      atomic.AddUint64(&c.id, 1),
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Post(
+		c.url, "application/json", bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected response %q", method, resp.Status)
+	}
+	var rpcResp ethereumRPCResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf(
+			"%s: rpc error %d: %s",
+			method, rpcResp.Error.Code, rpcResp.Error.Message,
+		)
+	}
+	return json.Unmarshal(rpcResp.Result, res)
+}
+
+type ethereumRPCBlock struct {
+	Number           string `json:"number"`
+	Hash             string `json:"hash"`
+	TransactionsRoot string `json:"transactionsRoot"`
+	Timestamp        string `json:"timestamp"`
+}
+
+func parseQuantity(s string) (uint64, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	return strconv.ParseUint(s[2:], 16, 64)
+}
+
+func parseData(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return nil, fmt.Errorf("invalid data %q", s)
+	}
+	return hex.DecodeString(s[2:])
+}
+
+// HeaderByNumber returns the header of the block at the given height, using
+// eth_getBlockByNumber.
+func (c *EthereumRPCClient) HeaderByNumber(
+	number uint64,
+) (*EthereumHeader, error) {
+	var block *ethereumRPCBlock
+	err := c.call(
+		"eth_getBlockByNumber", &block,
+		"0x"+strconv.FormatUint(number, 16), false,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+	n, err := parseQuantity(block.Number)
+	if err != nil {
+		return nil, err
+	}
+	if n != number {
+		return nil, fmt.Errorf("expected block %d, got %d", number, n)
+	}
+	hash, err := parseData(block.Hash)
+	if err != nil {
+		return nil, err
+	}
+	transactionsRoot, err := parseData(block.TransactionsRoot)
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := parseQuantity(block.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return &EthereumHeader{
+		Number:           n,
+		Hash:             hash,
+		TransactionsRoot: transactionsRoot,
+		Timestamp:        time.Unix(int64(timestamp), 0).UTC(),
+	}, nil
+}
+
+// BlockNumber returns the number of the most recent block, using
+// eth_blockNumber.
+func (c *EthereumRPCClient) BlockNumber() (uint64, error) {
+	var number string
+	if err := c.call("eth_blockNumber", &number); err != nil {
+		return 0, err
+	}
+	return parseQuantity(number)
+}
+
+// An EthereumAttestationVerifier uses an EthereumHeaderSource to verify
+// ethereum attestations.
+type EthereumAttestationVerifier struct {
+	source EthereumHeaderSource
+}
+
+func NewEthereumAttestationVerifier(
+	s EthereumHeaderSource,
+) *EthereumAttestationVerifier {
+	return &EthereumAttestationVerifier{s}
+}
+
+// VerifyAttestation checks an EthereumAttestation using a given hash digest.
+// It returns the time of the block if the verification succeeds, an error
+// otherwise.
+func (v *EthereumAttestationVerifier) VerifyAttestation(
+	digest []byte, a *opentimestamps.EthereumAttestation,
+) (*time.Time, error) {
+	h, err := v.source.HeaderByNumber(a.Height)
+	if err != nil {
+		return nil, err
+	}
+	err = a.VerifyAgainstTransactionsRoot(digest, h.TransactionsRoot)
+	if err != nil {
+		return nil, err
+	}
+	utc := h.Timestamp.UTC()
+	return &utc, nil
+}
+
+// An EthereumVerification is the result of verifying an EthereumAttestation
+type EthereumVerification struct {
+	Timestamp       *opentimestamps.Timestamp
+	Attestation     *opentimestamps.EthereumAttestation
+	AttestationTime *time.Time
+	Error           error
+}
+
+// EthereumVerifications returns all ethereum attestation results for the
+// timestamp.
+func (v *EthereumAttestationVerifier) EthereumVerifications(
+	t *opentimestamps.Timestamp,
+) (res []EthereumVerification) {
+	t.Walk(func(ts *opentimestamps.Timestamp) {
+		for _, att := range ts.Attestations {
+			ethAtt, ok := att.(*opentimestamps.EthereumAttestation)
+			if !ok {
+				continue
+			}
+			attTime, err := v.VerifyAttestation(ts.Message, ethAtt)
+			res = append(res, EthereumVerification{
+				Timestamp:       ts,
+				Attestation:     ethAtt,
+				AttestationTime: attTime,
+				Error:           err,
+			})
+		}
+	})
+	return res
+}
+
+// Verify returns the earliest ethereum-attested time, or nil if none can be
+// found or verified successfully.
+func (v *EthereumAttestationVerifier) Verify(
+	t *opentimestamps.Timestamp,
+) (ret *time.Time, err error) {
+	res := v.EthereumVerifications(t)
+	for _, r := range res {
+		if r.Error != nil {
+			err = r.Error
+			continue
+		}
+		if ret == nil || r.AttestationTime.Before(*ret) {
+			ret = r.AttestationTime
+		}
+	}
+	return
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEthereumNode serves eth_getBlockByNumber for a fixed set of headers
+type fakeEthereumNode struct {
+	headers map[uint64]*EthereumHeader
+}
+
+func (f *fakeEthereumNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req ethereumRPCRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	if req.Method == "eth_blockNumber" {
+		var best uint64
+		for number := range f.headers {
+			if number > best {
+				best = number
+			}
+		}
+		resp["result"] = "0x" + strconv.FormatUint(best, 16)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	if req.Method != "eth_getBlockByNumber" || len(req.Params) != 2 {
+		resp["error"] = ethereumRPCError{-32601, "method not found"}
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	number, err := parseQuantity(req.Params[0].(string))
+	if err != nil {
+		resp["error"] = ethereumRPCError{-32602, err.Error()}
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	h, ok := f.headers[number]
+	if !ok {
+		resp["result"] = nil
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	resp["result"] = ethereumRPCBlock{
+		Number:           "0x" + strconv.FormatUint(h.Number, 16),
+		Hash:             "0x" + hex.EncodeToString(h.Hash),
+		TransactionsRoot: "0x" + hex.EncodeToString(h.TransactionsRoot),
+		Timestamp:        "0x" + strconv.FormatInt(h.Timestamp.Unix(), 16),
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+const ethereumTag = "30fe8087b5c7ead7"
+
+func TestEthereumVerifier(t *testing.T) {
+	message := []byte("hello ethereum")
+	digest := sha256.Sum256(message)
+	blockTime := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	node := &fakeEthereumNode{map[uint64]*EthereumHeader{
+		100: {
+			Number:           100,
+			Hash:             bytes.Repeat([]byte{0xaa}, 32),
+			TransactionsRoot: digest[:],
+			Timestamp:        blockTime,
+		},
+		101: {
+			Number:           101,
+			Hash:             bytes.Repeat([]byte{0xbb}, 32),
+			TransactionsRoot: bytes.Repeat([]byte{0xcc}, 32),
+			Timestamp:        blockTime.Add(time.Minute),
+		},
+	}}
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	verifier := NewEthereumAttestationVerifier(
+		NewEthereumRPCClient(server.URL),
+	)
+
+	ts := newAttestedTimestamp(t, message, ethereumTag, 100)
+	results := verifier.EthereumVerifications(ts)
+	require.Equal(t, 1, len(results))
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, uint64(100), results[0].Attestation.Height)
+	assert.Equal(t, blockTime, *results[0].AttestationTime)
+
+	verifiedTime, err := verifier.Verify(ts)
+	require.NoError(t, err)
+	assert.Equal(t, blockTime, *verifiedTime)
+
+	confirmations, err := verifier.Confirmations(results[0].Attestation)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), confirmations)
+
+	// transactions root mismatch
+	verifiedTime, err = verifier.Verify(newAttestedTimestamp(
+		t, message, ethereumTag, 101,
+	))
+	assert.Error(t, err)
+	assert.Nil(t, verifiedTime)
+
+	// block not found
+	verifiedTime, err = verifier.Verify(newAttestedTimestamp(
+		t, message, ethereumTag, 102,
+	))
+	assert.Error(t, err)
+	assert.Nil(t, verifiedTime)
+}
@@ -0,0 +1,275 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// A ChainSource is a BlockHeaderSource that can also report the height of
+// the best chain. It is implemented by *btcrpcclient.Client.
+type ChainSource interface {
+	BlockHeaderSource
+	BlockCountSource
+}
+
+// headerRecordSize is the size of a height and a serialized header in a
+// header cache file.
+const headerRecordSize = 8 + wire.MaxBlockHeaderPayload
+
+// A HeaderCache is a BlockHeaderSource that keeps recently used headers of
+// another source in memory. Only blocks with at least minDepth
+// confirmations are cached, so a reorg near the tip is never hidden by the
+// cache. The cache can be persisted with Save and Load. It is safe for
+// concurrent use.
+//
+// Blocks restored by Load are checked against the source on first use, and
+// dropped if they have been reorged out or are no longer deep enough.
+type HeaderCache struct {
+	source   ChainSource
+	size     int
+	minDepth int64
+
+	mu      sync.Mutex
+	lru     *list.List
+	heights map[int64]*list.Element
+	hashes  map[chainhash.Hash]*list.Element
+}
+
+type cachedHeader struct {
+	height int64
+	hash   chainhash.Hash
+	// header is nil until it is requested
+	header *wire.BlockHeader
+	// loaded is true until a block restored by Load is checked against the
+	// source
+	loaded bool
+}
+
+// NewHeaderCache returns a cache holding up to size blocks with at least
+// minDepth confirmations.
+func NewHeaderCache(
+	source ChainSource, size int, minDepth int64,
+) *HeaderCache {
+	return &HeaderCache{
+		source:   source,
+		size:     size,
+		minDepth: minDepth,
+		lru:      list.New(),
+		heights:  map[int64]*list.Element{},
+		hashes:   map[chainhash.Hash]*list.Element{},
+	}
+}
+
+// Len returns the number of cached blocks.
+func (c *HeaderCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// add caches a block and evicts the least recently used ones over the size
+// limit. The caller must hold c.mu.
+func (c *HeaderCache) add(entry *cachedHeader) *list.Element {
+	if e, ok := c.heights[entry.height]; ok {
+		c.remove(e)
+	}
+	e := c.lru.PushFront(entry)
+	c.heights[entry.height] = e
+	c.hashes[entry.hash] = e
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+	return e
+}
+
+// remove drops a cached block. The caller must hold c.mu.
+func (c *HeaderCache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*cachedHeader)
+	delete(c.heights, entry.height)
+	delete(c.hashes, entry.hash)
+}
+
+// deep returns true if the block at the given height may be cached.
+func (c *HeaderCache) deep(height int64) (bool, error) {
+	if c.minDepth <= 0 {
+		return true, nil
+	}
+	count, err := c.source.GetBlockCount()
+	if err != nil {
+		return false, err
+	}
+	return count-height+1 >= c.minDepth, nil
+}
+
+func (c *HeaderCache) unwrapSource() BlockHeaderSource {
+	return c.source
+}
+
+// GetBlockCount returns the best height of the underlying source. It is
+// never cached.
+func (c *HeaderCache) GetBlockCount() (int64, error) {
+	return c.source.GetBlockCount()
+}
+
+// GetBlockHash returns the hash of the block at the given height.
+func (c *HeaderCache) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	c.mu.Lock()
+	if e, ok := c.heights[height]; ok && !e.Value.(*cachedHeader).loaded {
+		c.lru.MoveToFront(e)
+		hash := e.Value.(*cachedHeader).hash
+		c.mu.Unlock()
+		return &hash, nil
+	}
+	c.mu.Unlock()
+
+	hash, err := c.source.GetBlockHash(height)
+	if err != nil {
+		return nil, err
+	}
+	deep, err := c.deep(height)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	e, ok := c.heights[height]
+	switch {
+	case ok && deep && e.Value.(*cachedHeader).hash == *hash:
+		// keeps the header of a loaded block confirmed by the source
+		e.Value.(*cachedHeader).loaded = false
+		c.lru.MoveToFront(e)
+	case deep:
+		c.add(&cachedHeader{height: height, hash: *hash})
+	case ok:
+		c.remove(e)
+	}
+	c.mu.Unlock()
+	return hash, nil
+}
+
+// GetBlockHeader returns the header of the block with the given hash. Only
+// headers of blocks previously looked up with GetBlockHash are cached, since
+// their height is needed to tell if they are deep enough.
+func (c *HeaderCache) GetBlockHeader(
+	hash *chainhash.Hash,
+) (*wire.BlockHeader, error) {
+	c.mu.Lock()
+	if e, ok := c.hashes[*hash]; ok && e.Value.(*cachedHeader).loaded {
+		height := e.Value.(*cachedHeader).height
+		c.mu.Unlock()
+		// checks the loaded block against the source
+		if _, err := c.GetBlockHash(height); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+	}
+	if e, ok := c.hashes[*hash]; ok {
+		entry := e.Value.(*cachedHeader)
+		if entry.header != nil && !entry.loaded {
+			c.lru.MoveToFront(e)
+			header := *entry.header
+			c.mu.Unlock()
+			return &header, nil
+		}
+	}
+	c.mu.Unlock()
+
+	header, err := c.source.GetBlockHeader(hash)
+	if err != nil {
+		return nil, err
+	}
+	if header.BlockHash() != *hash {
+		return nil, fmt.Errorf("header does not match block hash %v", hash)
+	}
+	c.mu.Lock()
+	if e, ok := c.hashes[*hash]; ok {
+		cached := *header
+		e.Value.(*cachedHeader).header = &cached
+	}
+	c.mu.Unlock()
+	return header, nil
+}
+
+// Save writes the cached headers to a file, replacing it atomically.
+func (c *HeaderCache) Save(path string) error {
+	buf := &bytes.Buffer{}
+	c.mu.Lock()
+	// oldest first, so Load restores the LRU order
+	for e := c.lru.Back(); e != nil; e = e.Prev() {
+		entry := e.Value.(*cachedHeader)
+		if entry.header == nil {
+			continue
+		}
+		var height [8]byte
+		binary.BigEndian.PutUint64(height[:], uint64(entry.height))
+		buf.Write(height[:])
+		if err := entry.header.Serialize(buf); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+	}
+	c.mu.Unlock()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".headers")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load adds the headers from a file written by Save to the cache. They are
+// checked against the source when first used. A missing file is not an
+// error.
+func (c *HeaderCache) Load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	record := make([]byte, headerRecordSize)
+	for {
+		_, err := io.ReadFull(r, record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", path, err)
+		}
+		header := &wire.BlockHeader{}
+		err = header.Deserialize(bytes.NewReader(record[8:]))
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", path, err)
+		}
+		c.mu.Lock()
+		c.add(&cachedHeader{
+			height: int64(binary.BigEndian.Uint64(record[:8])),
+			hash:   header.BlockHash(),
+			header: header,
+			loaded: true,
+		})
+		c.mu.Unlock()
+	}
+}
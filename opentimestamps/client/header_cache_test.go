@@ -0,0 +1,164 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingSource counts the lookups made on a fakeHeaderSource
+type countingSource struct {
+	*fakeHeaderSource
+	mu          sync.Mutex
+	hashCalls   int
+	headerCalls int
+}
+
+func (c *countingSource) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	c.mu.Lock()
+	c.hashCalls += 1
+	c.mu.Unlock()
+	return c.fakeHeaderSource.GetBlockHash(height)
+}
+
+func (c *countingSource) GetBlockHeader(
+	hash *chainhash.Hash,
+) (*wire.BlockHeader, error) {
+	c.mu.Lock()
+	c.headerCalls += 1
+	c.mu.Unlock()
+	return c.fakeHeaderSource.GetBlockHeader(hash)
+}
+
+func (c *countingSource) calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hashCalls + c.headerCalls
+}
+
+func newCountingSource(best int64) *countingSource {
+	s := &countingSource{fakeHeaderSource: newFakeHeaderSource()}
+	s.fill(best)
+	return s
+}
+
+func TestHeaderCache(t *testing.T) {
+	source := newCountingSource(100)
+	cache := NewHeaderCache(source, 3, 6)
+
+	for i := 0; i < 2; i++ {
+		for _, height := range []int64{90, 91, 92} {
+			_, err := getBlockHeader(cache, uint64(height))
+			require.NoError(t, err)
+		}
+	}
+	assert.Equal(t, 6, source.calls())
+	assert.Equal(t, 3, cache.Len())
+
+	// blocks with fewer than 6 confirmations are not cached
+	for i := 0; i < 2; i++ {
+		_, err := getBlockHeader(cache, 96)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 10, source.calls())
+	_, err := getBlockHeader(cache, 95)
+	require.NoError(t, err)
+	assert.Equal(t, 3, cache.Len())
+
+	// 95 evicted 90, the least recently used block
+	_, err = getBlockHeader(cache, 90)
+	require.NoError(t, err)
+	assert.Equal(t, 14, source.calls())
+	_, err = getBlockHeader(cache, 95)
+	require.NoError(t, err)
+	assert.Equal(t, 14, source.calls())
+
+	_, err = cache.GetBlockHash(1000)
+	assert.Error(t, err)
+}
+
+func TestHeaderCacheConcurrent(t *testing.T) {
+	source := newCountingSource(100)
+	cache := NewHeaderCache(source, 10, 6)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				height := uint64(80 + (i+j)%15)
+				h, err := getBlockHeader(cache, height)
+				assert.NoError(t, err)
+				assert.Equal(t, source.headers[source.hashes[int64(height)]], h)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 10, cache.Len())
+}
+
+func TestHeaderCachePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gots-headers")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "headers")
+
+	source := newCountingSource(100)
+	cache := NewHeaderCache(source, 10, 6)
+	require.NoError(t, cache.Load(path))
+	for _, height := range []uint64{50, 60, 70} {
+		_, err := getBlockHeader(cache, height)
+		require.NoError(t, err)
+	}
+	// a hash without header is not persisted
+	_, err = cache.GetBlockHash(80)
+	require.NoError(t, err)
+	require.NoError(t, cache.Save(path))
+
+	// restored blocks are checked against the source once, without
+	// fetching their headers again
+	source = newCountingSource(100)
+	restored := NewHeaderCache(source, 10, 6)
+	require.NoError(t, restored.Load(path))
+	assert.Equal(t, 3, restored.Len())
+	for i := 0; i < 2; i++ {
+		for _, height := range []uint64{50, 60, 70} {
+			h, err := getBlockHeader(restored, height)
+			require.NoError(t, err)
+			assert.Equal(t, source.headers[source.hashes[int64(height)]], h)
+		}
+	}
+	assert.Equal(t, 3, source.hashCalls)
+	assert.Equal(t, 0, source.headerCalls)
+
+	// restored blocks that were reorged out are dropped
+	source = newCountingSource(100)
+	restored = NewHeaderCache(source, 10, 6)
+	require.NoError(t, restored.Load(path))
+	stale := source.hashes[60]
+	delete(source.headers, stale)
+	source.add(60, &wire.BlockHeader{Nonce: 60})
+	h, err := getBlockHeader(restored, 60)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(60), h.Nonce)
+	_, err = restored.GetBlockHeader(&stale)
+	assert.Error(t, err)
+
+	// and so are those no longer deep enough
+	source = newCountingSource(72)
+	restored = NewHeaderCache(source, 10, 6)
+	require.NoError(t, restored.Load(path))
+	_, err = getBlockHeader(restored, 70)
+	require.NoError(t, err)
+	assert.Equal(t, 2, restored.Len())
+
+	require.NoError(t, ioutil.WriteFile(path, []byte{0x01}, 0600))
+	assert.Error(t, restored.Load(path))
+}
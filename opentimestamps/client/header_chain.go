@@ -0,0 +1,422 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// headerChainBatch is the number of headers validated at once when a header
+// file is loaded.
+const headerChainBatch = 2000
+
+// maxTimeOffset is how far in the future the time of a header may be.
+const maxTimeOffset = 2 * time.Hour
+
+// minChainWork is the total work a chain of the network needs before its
+// blocks are used. It is a lower bound of the work of the mainnet chain at
+// its last checkpoint. Test networks have no minimum, their work is cheap.
+var minChainWork = map[wire.BitcoinNet]*big.Int{
+	wire.MainNet: new(big.Int).Lsh(big.NewInt(1), 86),
+}
+
+// A HeaderChain is a chain of bitcoin block headers starting at the genesis
+// block of a network. Headers are only added if they have valid proof of
+// work, so attestations can be verified against it without trusting a node.
+// It implements ChainSource and is safe for concurrent use.
+//
+// Headers must match the checkpoints of the network, can't fork below the
+// last checkpoint in the chain and can't be more than two hours in the
+// future. Blocks are only returned once the chain has the minimum work of
+// the network, so a short chain of cheap blocks isn't trusted.
+//
+// On networks with the minimum difficulty rule, like testnet and regtest,
+// the difficulty of a header is only checked against the network limit.
+type HeaderChain struct {
+	params  *chaincfg.Params
+	minWork *big.Int
+	now     func() time.Time
+
+	mu      sync.RWMutex
+	headers []wire.BlockHeader
+	hashes  []chainhash.Hash
+	heights map[chainhash.Hash]int64
+	work    *big.Int
+}
+
+// NewHeaderChain returns a chain holding the genesis block of the network.
+func NewHeaderChain(params *chaincfg.Params) *HeaderChain {
+	minWork := minChainWork[params.Net]
+	if minWork == nil {
+		minWork = new(big.Int)
+	}
+	c := &HeaderChain{
+		params:  params,
+		minWork: minWork,
+		now:     time.Now,
+		heights: map[chainhash.Hash]int64{},
+		work:    new(big.Int),
+	}
+	c.append(params.GenesisBlock.Header)
+	return c
+}
+
+// Params returns the network of the chain.
+func (c *HeaderChain) Params() *chaincfg.Params {
+	return c.params
+}
+
+// append adds a header to the tip. The caller must hold c.mu.
+func (c *HeaderChain) append(h wire.BlockHeader) {
+	hash := h.BlockHash()
+	c.heights[hash] = int64(len(c.headers))
+	c.headers = append(c.headers, h)
+	c.hashes = append(c.hashes, hash)
+	c.work.Add(c.work, blockchain.CalcWork(h.Bits))
+}
+
+// truncate removes the headers above the given height. The caller must hold
+// c.mu.
+func (c *HeaderChain) truncate(height int64) {
+	for _, hash := range c.hashes[height+1:] {
+		delete(c.heights, hash)
+	}
+	for _, h := range c.headers[height+1:] {
+		c.work.Sub(c.work, blockchain.CalcWork(h.Bits))
+	}
+	c.headers = c.headers[:height+1]
+	c.hashes = c.hashes[:height+1]
+}
+
+// checkWork returns an error if the chain doesn't have the minimum work of
+// the network yet. The caller must hold c.mu.
+func (c *HeaderChain) checkWork() error {
+	if c.work.Cmp(c.minWork) < 0 {
+		return fmt.Errorf(
+			"chain work %x below the minimum %x of %s",
+			c.work, c.minWork, c.params.Name,
+		)
+	}
+	return nil
+}
+
+// height returns the height of the tip, whatever its work.
+func (c *HeaderChain) height() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return int64(len(c.headers) - 1)
+}
+
+// GetBlockCount returns the height of the tip.
+func (c *HeaderChain) GetBlockCount() (int64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if err := c.checkWork(); err != nil {
+		return 0, err
+	}
+	return int64(len(c.headers) - 1), nil
+}
+
+// GetBlockHash returns the hash of the block at the given height.
+func (c *HeaderChain) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if err := c.checkWork(); err != nil {
+		return nil, err
+	}
+	if height < 0 || height >= int64(len(c.hashes)) {
+		return nil, fmt.Errorf("block height %d out of range", height)
+	}
+	hash := c.hashes[height]
+	return &hash, nil
+}
+
+// GetBlockHeader returns the header of the block with the given hash.
+func (c *HeaderChain) GetBlockHeader(
+	hash *chainhash.Hash,
+) (*wire.BlockHeader, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if err := c.checkWork(); err != nil {
+		return nil, err
+	}
+	height, ok := c.heights[*hash]
+	if !ok {
+		return nil, fmt.Errorf("block %v not found", hash)
+	}
+	h := c.headers[height]
+	return &h, nil
+}
+
+// Locator returns hashes of the chain from the tip back to the genesis
+// block, dense near the tip and exponentially sparser below, for use in a
+// getheaders message.
+func (c *HeaderChain) Locator() []*chainhash.Hash {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var locator []*chainhash.Hash
+	step := int64(1)
+	for height := int64(len(c.hashes) - 1); height > 0; height -= step {
+		hash := c.hashes[height]
+		locator = append(locator, &hash)
+		if len(locator) >= 10 {
+			step *= 2
+		}
+	}
+	genesis := c.hashes[0]
+	return append(locator, &genesis)
+}
+
+// Connect validates headers following a block of the chain and adds them.
+// Headers already in the chain are skipped. If the headers fork from the
+// chain below its tip, they replace the blocks above the fork only if they
+// have more work and the fork is above the last checkpoint in the chain.
+// Connect returns the number of blocks added.
+func (c *HeaderChain) Connect(headers []*wire.BlockHeader) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(headers) == 0 {
+		return 0, nil
+	}
+	fork, ok := c.heights[headers[0].PrevBlock]
+	if !ok {
+		return 0, fmt.Errorf(
+			"header %v does not connect to the chain",
+			headers[0].BlockHash(),
+		)
+	}
+	for len(headers) > 0 && fork+1 < int64(len(c.headers)) &&
+		headers[0].BlockHash() == c.hashes[fork+1] {
+		headers = headers[1:]
+		fork += 1
+	}
+	if len(headers) == 0 {
+		return 0, nil
+	}
+	tip := int64(len(c.headers) - 1)
+	if cp := c.lastCheckpoint(tip); fork < cp {
+		return 0, fmt.Errorf(
+			"fork at height %d below checkpoint at %d", fork, cp,
+		)
+	}
+
+	// ancestor returns the header at a height of the new branch
+	ancestor := func(height int64) *wire.BlockHeader {
+		if height <= fork {
+			return &c.headers[height]
+		}
+		return headers[height-fork-1]
+	}
+	prevHash := c.hashes[fork]
+	newWork := new(big.Int)
+	for i, h := range headers {
+		if h.PrevBlock != prevHash {
+			return 0, fmt.Errorf(
+				"header %v does not follow %v", h.BlockHash(), prevHash,
+			)
+		}
+		height := fork + 1 + int64(i)
+		if err := c.checkHeader(height, h, ancestor); err != nil {
+			return 0, fmt.Errorf("invalid header at height %d: %v", height, err)
+		}
+		newWork.Add(newWork, blockchain.CalcWork(h.Bits))
+		prevHash = h.BlockHash()
+	}
+
+	if fork+1 < int64(len(c.headers)) {
+		oldWork := new(big.Int)
+		for _, h := range c.headers[fork+1:] {
+			oldWork.Add(oldWork, blockchain.CalcWork(h.Bits))
+		}
+		if newWork.Cmp(oldWork) <= 0 {
+			return 0, nil
+		}
+		c.truncate(fork)
+	}
+	for _, h := range headers {
+		c.append(*h)
+	}
+	return len(headers), nil
+}
+
+// checkpoint returns the hash of the checkpoint at the given height, or nil
+// if there is none.
+func (c *HeaderChain) checkpoint(height int64) *chainhash.Hash {
+	for _, cp := range c.params.Checkpoints {
+		if int64(cp.Height) == height {
+			return cp.Hash
+		}
+	}
+	return nil
+}
+
+// lastCheckpoint returns the height of the last checkpoint at or below the
+// given height. The genesis block counts as a checkpoint.
+func (c *HeaderChain) lastCheckpoint(height int64) int64 {
+	var last int64
+	for _, cp := range c.params.Checkpoints {
+		if int64(cp.Height) <= height && int64(cp.Height) > last {
+			last = int64(cp.Height)
+		}
+	}
+	return last
+}
+
+// checkProofOfWork returns an error if the target of the header is above
+// the limit of the network, or its hash is above the target.
+func checkProofOfWork(h *wire.BlockHeader, params *chaincfg.Params) error {
+	target := blockchain.CompactToBig(h.Bits)
+	if target.Sign() <= 0 || target.Cmp(params.PowLimit) > 0 {
+		return fmt.Errorf("target %08x out of range", h.Bits)
+	}
+	hash := h.BlockHash()
+	if blockchain.HashToBig(&hash).Cmp(target) > 0 {
+		return fmt.Errorf("hash %v above target %08x", hash, h.Bits)
+	}
+	return nil
+}
+
+// checkHeader validates the checkpoint, difficulty, proof of work and time
+// of a header at the given height. ancestor returns the headers below it.
+func (c *HeaderChain) checkHeader(
+	height int64, h *wire.BlockHeader,
+	ancestor func(height int64) *wire.BlockHeader,
+) error {
+	if cp := c.checkpoint(height); cp != nil {
+		if hash := h.BlockHash(); !hash.IsEqual(cp) {
+			return fmt.Errorf("block %v does not match checkpoint %v", hash, cp)
+		}
+	}
+	if !c.params.ReduceMinDifficulty {
+		if bits := c.requiredBits(height, ancestor); h.Bits != bits {
+			return fmt.Errorf("target %08x, expected %08x", h.Bits, bits)
+		}
+	}
+	if err := checkProofOfWork(h, c.params); err != nil {
+		return err
+	}
+
+	var prevTimes []time.Time
+	for i := int64(1); i <= medianTimeBlocks && i <= height; i++ {
+		prevTimes = append(prevTimes, ancestor(height-i).Timestamp)
+	}
+	if mtp := medianTime(prevTimes); !h.Timestamp.After(mtp) {
+		return fmt.Errorf(
+			"time %v not after median time past %v", h.Timestamp, mtp,
+		)
+	}
+	if limit := c.now().Add(maxTimeOffset); h.Timestamp.After(limit) {
+		return fmt.Errorf("time %v too far in the future", h.Timestamp)
+	}
+	return nil
+}
+
+// requiredBits returns the difficulty of the block at the given height,
+// following bitcoin's retargeting rules.
+func (c *HeaderChain) requiredBits(
+	height int64, ancestor func(height int64) *wire.BlockHeader,
+) uint32 {
+	last := ancestor(height - 1)
+	blocksPerRetarget := int64(
+		c.params.TargetTimespan / c.params.TargetTimePerBlock,
+	)
+	if height%blocksPerRetarget != 0 {
+		return last.Bits
+	}
+
+	first := ancestor(height - blocksPerRetarget)
+	targetTimespan := int64(c.params.TargetTimespan / time.Second)
+	minTimespan := targetTimespan / c.params.RetargetAdjustmentFactor
+	maxTimespan := targetTimespan * c.params.RetargetAdjustmentFactor
+	timespan := last.Timestamp.Unix() - first.Timestamp.Unix()
+	if timespan < minTimespan {
+		timespan = minTimespan
+	} else if timespan > maxTimespan {
+		timespan = maxTimespan
+	}
+
+	target := blockchain.CompactToBig(last.Bits)
+	target.Mul(target, big.NewInt(timespan))
+	target.Div(target, big.NewInt(targetTimespan))
+	if target.Cmp(c.params.PowLimit) > 0 {
+		target.Set(c.params.PowLimit)
+	}
+	return blockchain.BigToCompact(target)
+}
+
+// Save writes the headers above the genesis block to a file, replacing it
+// atomically.
+func (c *HeaderChain) Save(path string) error {
+	buf := &bytes.Buffer{}
+	c.mu.RLock()
+	for i := 1; i < len(c.headers); i++ {
+		if err := c.headers[i].Serialize(buf); err != nil {
+			c.mu.RUnlock()
+			return err
+		}
+	}
+	c.mu.RUnlock()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".headers")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load validates the headers from a file written by Save and connects them
+// to the chain. A missing file is not an error.
+func (c *HeaderChain) Load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var batch []*wire.BlockHeader
+	for {
+		h := &wire.BlockHeader{}
+		err := h.Deserialize(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", path, err)
+		}
+		batch = append(batch, h)
+		if len(batch) == headerChainBatch {
+			if _, err := c.Connect(batch); err != nil {
+				return fmt.Errorf("error reading %s: %v", path, err)
+			}
+			batch = nil
+		}
+	}
+	if _, err := c.Connect(batch); err != nil {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mineHeader returns a regtest header on top of prev with a valid proof of
+// work, or an invalid one if valid is false.
+func mineHeader(
+	prev *wire.BlockHeader, root chainhash.Hash, valid bool,
+) *wire.BlockHeader {
+	h := &wire.BlockHeader{
+		Version:    4,
+		PrevBlock:  prev.BlockHash(),
+		MerkleRoot: root,
+		Timestamp:  prev.Timestamp.Add(10 * time.Minute),
+		Bits:       chaincfg.RegressionNetParams.PowLimitBits,
+	}
+	return solveHeader(h, valid)
+}
+
+// solveHeader changes the nonce until the proof of work is valid, or invalid
+// if valid is false.
+func solveHeader(h *wire.BlockHeader, valid bool) *wire.BlockHeader {
+	target := blockchain.CompactToBig(h.Bits)
+	for {
+		hash := h.BlockHash()
+		if (blockchain.HashToBig(&hash).Cmp(target) <= 0) == valid {
+			return h
+		}
+		h.Nonce += 1
+	}
+}
+
+// mineChain returns n regtest headers following prev. roots sets the merkle
+// roots at the given heights.
+func mineChain(
+	prev *wire.BlockHeader, height int64, n int,
+	roots map[int64]chainhash.Hash,
+) []*wire.BlockHeader {
+	var headers []*wire.BlockHeader
+	for i := 0; i < n; i++ {
+		height += 1
+		prev = mineHeader(prev, roots[height], true)
+		headers = append(headers, prev)
+	}
+	return headers
+}
+
+func TestHeaderChainConnect(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain := NewHeaderChain(params)
+	genesis := &params.GenesisBlock.Header
+
+	headers := mineChain(genesis, 0, 20, nil)
+	n, err := chain.Connect(headers[:10])
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	// overlapping headers are skipped
+	n, err = chain.Connect(headers[5:])
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+
+	count, err := chain.GetBlockCount()
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), count)
+	hash, err := chain.GetBlockHash(20)
+	require.NoError(t, err)
+	assert.Equal(t, headers[19].BlockHash(), *hash)
+	h, err := chain.GetBlockHeader(hash)
+	require.NoError(t, err)
+	assert.Equal(t, *headers[19], *h)
+	_, err = chain.GetBlockHash(21)
+	assert.Error(t, err)
+
+	locator := chain.Locator()
+	assert.Equal(t, headers[19].BlockHash(), *locator[0])
+	assert.Equal(t, *params.GenesisHash, *locator[len(locator)-1])
+
+	tip := headers[19]
+	_, err = chain.Connect([]*wire.BlockHeader{
+		mineHeader(tip, chainhash.Hash{}, false),
+	})
+	assert.Error(t, err)
+
+	easy := mineHeader(tip, chainhash.Hash{}, true)
+	easy.Bits = 0x2100ffff
+	_, err = chain.Connect([]*wire.BlockHeader{easy})
+	assert.Error(t, err)
+
+	early := mineHeader(tip, chainhash.Hash{}, true)
+	early.Timestamp = headers[5].Timestamp
+	_, err = chain.Connect([]*wire.BlockHeader{solveHeader(early, true)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "median time past")
+
+	orphan := mineChain(genesis, 0, 2, map[int64]chainhash.Hash{1: {2}})[1]
+	_, err = chain.Connect([]*wire.BlockHeader{orphan})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not connect")
+
+	count, _ = chain.GetBlockCount()
+	assert.Equal(t, int64(20), count)
+}
+
+func TestHeaderChainFork(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain := NewHeaderChain(params)
+	headers := mineChain(&params.GenesisBlock.Header, 0, 10, nil)
+	_, err := chain.Connect(headers)
+	require.NoError(t, err)
+
+	// a branch from height 5 with less work is ignored
+	root := chainhash.Hash{1}
+	fork := mineChain(headers[4], 5, 5, map[int64]chainhash.Hash{6: root})
+	n, err := chain.Connect(fork)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	hash, _ := chain.GetBlockHash(10)
+	assert.Equal(t, headers[9].BlockHash(), *hash)
+
+	// a longer one replaces the chain
+	fork = append(fork, mineChain(fork[4], 10, 1, nil)...)
+	n, err = chain.Connect(fork)
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+	count, _ := chain.GetBlockCount()
+	assert.Equal(t, int64(11), count)
+	hash, _ = chain.GetBlockHash(6)
+	assert.Equal(t, fork[0].BlockHash(), *hash)
+	_, err = chain.GetBlockHeader(&chainhash.Hash{})
+	assert.Error(t, err)
+	h := headers[7].BlockHash()
+	_, err = chain.GetBlockHeader(&h)
+	assert.Error(t, err)
+}
+
+func TestHeaderChainDifficulty(t *testing.T) {
+	// headers with the wrong difficulty are rejected on mainnet before the
+	// proof of work is checked
+	params := &chaincfg.MainNetParams
+	chain := NewHeaderChain(params)
+	genesis := &params.GenesisBlock.Header
+	h := &wire.BlockHeader{
+		Version:   1,
+		PrevBlock: genesis.BlockHash(),
+		Timestamp: genesis.Timestamp.Add(10 * time.Minute),
+		Bits:      0x1c00ffff,
+	}
+	_, err := chain.Connect([]*wire.BlockHeader{h})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expected 1d00ffff")
+
+	h.Bits = genesis.Bits
+	_, err = chain.Connect([]*wire.BlockHeader{h})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "above target")
+
+	// retarget after two weeks worth of blocks that took one week
+	last := &wire.BlockHeader{
+		Bits: 0x1b0404cb, Timestamp: time.Unix(2016*300, 0),
+	}
+	first := &wire.BlockHeader{Bits: 0x1b0404cb, Timestamp: time.Unix(0, 0)}
+	bits := chain.requiredBits(2016, func(height int64) *wire.BlockHeader {
+		if height == 0 {
+			return first
+		}
+		return last
+	})
+	expected := blockchain.CompactToBig(0x1b0404cb)
+	expected.Rsh(expected, 1)
+	assert.Equal(t, blockchain.BigToCompact(expected), bits)
+	assert.Equal(t, uint32(0x1b0404cb), chain.requiredBits(
+		2015, func(int64) *wire.BlockHeader { return last },
+	))
+}
+
+func TestHeaderChainPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gots-headers")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "headers")
+
+	params := &chaincfg.RegressionNetParams
+	chain := NewHeaderChain(params)
+	require.NoError(t, chain.Load(path))
+	headers := mineChain(&params.GenesisBlock.Header, 0, 2500, nil)
+	_, err = chain.Connect(headers)
+	require.NoError(t, err)
+	require.NoError(t, chain.Save(path))
+
+	loaded := NewHeaderChain(params)
+	require.NoError(t, loaded.Load(path))
+	count, _ := loaded.GetBlockCount()
+	assert.Equal(t, int64(2500), count)
+	hash, _ := loaded.GetBlockHash(2500)
+	assert.Equal(t, headers[2499].BlockHash(), *hash)
+
+	// headers of another network don't connect
+	assert.Error(t, NewHeaderChain(&chaincfg.MainNetParams).Load(path))
+
+	// neither do corrupted ones
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	data[80*100+4] ^= 1
+	require.NoError(t, ioutil.WriteFile(path, data, 0644))
+	assert.Error(t, NewHeaderChain(params).Load(path))
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"time"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+)
+
+// A LitecoinAttestationVerifier uses a litecoind RPC connection or another
+// BlockHeaderSource to verify litecoin headers.
+type LitecoinAttestationVerifier struct {
+	source BlockHeaderSource
+}
+
+func NewLitecoinAttestationVerifier(
+	s BlockHeaderSource,
+) *LitecoinAttestationVerifier {
+	return &LitecoinAttestationVerifier{s}
+}
+
+// VerifyAttestation checks a LitecoinAttestation using a given hash digest.
+// It returns the time of the block if the verification succeeds, an error
+// otherwise.
+func (v *LitecoinAttestationVerifier) VerifyAttestation(
+	digest []byte, a *opentimestamps.LitecoinAttestation,
+) (*time.Time, error) {
+	h, err := getBlockHeader(v.source, a.Height)
+	if err != nil {
+		return nil, err
+	}
+	err = a.VerifyAgainstBlockHash(digest, h.MerkleRoot[:])
+	if err != nil {
+		return nil, err
+	}
+	utc := h.Timestamp.UTC()
+	return &utc, nil
+}
+
+// A LitecoinVerification is the result of verifying a LitecoinAttestation
+type LitecoinVerification struct {
+	Timestamp       *opentimestamps.Timestamp
+	Attestation     *opentimestamps.LitecoinAttestation
+	AttestationTime *time.Time
+	Error           error
+}
+
+// LitecoinVerifications returns all litecoin attestation results for the
+// timestamp.
+func (v *LitecoinAttestationVerifier) LitecoinVerifications(
+	t *opentimestamps.Timestamp,
+) (res []LitecoinVerification) {
+	t.Walk(func(ts *opentimestamps.Timestamp) {
+		for _, att := range ts.Attestations {
+			ltcAtt, ok := att.(*opentimestamps.LitecoinAttestation)
+			if !ok {
+				continue
+			}
+			attTime, err := v.VerifyAttestation(ts.Message, ltcAtt)
+			res = append(res, LitecoinVerification{
+				Timestamp:       ts,
+				Attestation:     ltcAtt,
+				AttestationTime: attTime,
+				Error:           err,
+			})
+		}
+	})
+	return res
+}
+
+// Verify returns the earliest litecoin-attested time, or nil if none can be
+// found or verified successfully.
+func (v *LitecoinAttestationVerifier) Verify(
+	t *opentimestamps.Timestamp,
+) (ret *time.Time, err error) {
+	res := v.LitecoinVerifications(t)
+	for _, r := range res {
+		if r.Error != nil {
+			err = r.Error
+			continue
+		}
+		if ret == nil || r.AttestationTime.Before(*ret) {
+			ret = r.AttestationTime
+		}
+	}
+	return
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHeaderSource is an in-memory BlockHeaderSource
+type fakeHeaderSource struct {
+	hashes  map[int64]chainhash.Hash
+	headers map[chainhash.Hash]*wire.BlockHeader
+}
+
+func newFakeHeaderSource() *fakeHeaderSource {
+	return &fakeHeaderSource{
+		hashes:  map[int64]chainhash.Hash{},
+		headers: map[chainhash.Hash]*wire.BlockHeader{},
+	}
+}
+
+func (f *fakeHeaderSource) add(height int64, h *wire.BlockHeader) {
+	hash := h.BlockHash()
+	f.hashes[height] = hash
+	f.headers[hash] = h
+}
+
+// fill adds headers for all missing heights up to the given one, so the
+// blocks around an attested block can be looked up.
+func (f *fakeHeaderSource) fill(upTo int64) {
+	for height := int64(0); height <= upTo; height++ {
+		if _, ok := f.hashes[height]; !ok {
+			f.add(height, &wire.BlockHeader{
+				Nonce:     uint32(height),
+				Timestamp: time.Unix(height*600, 0),
+			})
+		}
+	}
+}
+
+func (f *fakeHeaderSource) GetBlockCount() (int64, error) {
+	var best int64
+	for height := range f.hashes {
+		if height > best {
+			best = height
+		}
+	}
+	return best, nil
+}
+
+func (f *fakeHeaderSource) GetBlockHash(
+	blockHeight int64,
+) (*chainhash.Hash, error) {
+	hash, ok := f.hashes[blockHeight]
+	if !ok {
+		return nil, fmt.Errorf("block height out of range")
+	}
+	return &hash, nil
+}
+
+func (f *fakeHeaderSource) GetBlockHeader(
+	blockHash *chainhash.Hash,
+) (*wire.BlockHeader, error) {
+	h, ok := f.headers[*blockHash]
+	if !ok {
+		return nil, fmt.Errorf("block not found")
+	}
+	return h, nil
+}
+
+// newAttestedTimestamp returns a timestamp that hashes the message with
+// SHA256 and attests the result with the given tag at the given height.
+func newAttestedTimestamp(
+	t *testing.T, message []byte, tag string, height byte,
+) *opentimestamps.Timestamp {
+	tagBytes, err := hex.DecodeString(tag)
+	require.NoError(t, err)
+	raw := []byte{0x08, 0x00}
+	raw = append(raw, tagBytes...)
+	raw = append(raw, 0x01, height)
+	ts, err := opentimestamps.NewTimestampFromReader(
+		bytes.NewReader(raw), message,
+	)
+	require.NoError(t, err)
+	return ts
+}
+
+const (
+	bitcoinTag  = "0588960d73d71901"
+	litecoinTag = "06869a0d73d71b45"
+)
+
+func TestLitecoinVerifier(t *testing.T) {
+	message := []byte("hello litecoin")
+	digest := sha256.Sum256(message)
+	blockTime := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	source := newFakeHeaderSource()
+	source.add(100, &wire.BlockHeader{
+		MerkleRoot: chainhash.Hash(digest),
+		Timestamp:  blockTime,
+	})
+	source.add(101, &wire.BlockHeader{
+		Timestamp: blockTime.Add(time.Minute),
+	})
+	verifier := NewLitecoinAttestationVerifier(source)
+
+	ts := newAttestedTimestamp(t, message, litecoinTag, 100)
+	results := verifier.LitecoinVerifications(ts)
+	require.Equal(t, 1, len(results))
+	require.NoError(t, results[0].Error)
+	assert.Equal(t, uint64(100), results[0].Attestation.Height)
+	assert.Equal(t, blockTime, *results[0].AttestationTime)
+
+	verifiedTime, err := verifier.Verify(ts)
+	require.NoError(t, err)
+	assert.Equal(t, blockTime, *verifiedTime)
+
+	// merkle root mismatch
+	verifiedTime, err = verifier.Verify(
+		newAttestedTimestamp(t, message, litecoinTag, 101),
+	)
+	assert.Error(t, err)
+	assert.Nil(t, verifiedTime)
+
+	// block not found
+	verifiedTime, err = verifier.Verify(
+		newAttestedTimestamp(t, message, litecoinTag, 102),
+	)
+	assert.Error(t, err)
+	assert.Nil(t, verifiedTime)
+
+	// bitcoin attestations are ignored
+	verifiedTime, err = verifier.Verify(
+		newAttestedTimestamp(t, message, bitcoinTag, 100),
+	)
+	assert.NoError(t, err)
+	assert.Nil(t, verifiedTime)
+}
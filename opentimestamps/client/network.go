@@ -0,0 +1,156 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// A BitcoinNetwork is a bitcoin network attestations can be verified on.
+// BitcoinAttestations don't record their network, so it has to be chosen
+// by the verifier.
+type BitcoinNetwork struct {
+	// Name is the name used on the command line, like "mainnet".
+	Name string
+	// Chain is the chain name reported by getblockchaininfo.
+	Chain  string
+	Params *chaincfg.Params
+	// RPCPort is the default port of the bitcoind JSON-RPC server.
+	RPCPort string
+	// DataSubdir is the subdirectory of the bitcoind data directory used
+	// for the network.
+	DataSubdir string
+	// Calendars are the default calendar servers. Public calendars only
+	// run on mainnet, so the other networks have none.
+	Calendars []string
+}
+
+var (
+	BitcoinMainnet = &BitcoinNetwork{
+		Name:    "mainnet",
+		Chain:   "main",
+		Params:  &chaincfg.MainNetParams,
+		RPCPort: "8332",
+		Calendars: []string{
+			"https://alice.btc.calendar.opentimestamps.org",
+			"https://bob.btc.calendar.opentimestamps.org",
+			"https://finney.calendar.eternitywall.com",
+			"https://btc.calendar.catallaxy.com",
+		},
+	}
+	BitcoinTestnet = &BitcoinNetwork{
+		Name:       "testnet",
+		Chain:      "test",
+		Params:     &chaincfg.TestNet3Params,
+		RPCPort:    "18332",
+		DataSubdir: "testnet3",
+	}
+	BitcoinSignet = &BitcoinNetwork{
+		Name:       "signet",
+		Chain:      "signet",
+		Params:     &chaincfg.SigNetParams,
+		RPCPort:    "38332",
+		DataSubdir: "signet",
+	}
+	BitcoinRegtest = &BitcoinNetwork{
+		Name:       "regtest",
+		Chain:      "regtest",
+		Params:     &chaincfg.RegressionNetParams,
+		RPCPort:    "18443",
+		DataSubdir: "regtest",
+	}
+)
+
+// BitcoinNetworks are the known networks.
+var BitcoinNetworks = []*BitcoinNetwork{
+	BitcoinMainnet, BitcoinTestnet, BitcoinSignet, BitcoinRegtest,
+}
+
+// BitcoinNetworkByName returns the network with the given name or chain
+// name, like "mainnet" or "main".
+func BitcoinNetworkByName(name string) (*BitcoinNetwork, error) {
+	for _, n := range BitcoinNetworks {
+		if strings.EqualFold(name, n.Name) || strings.EqualFold(name, n.Chain) {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown bitcoin network %q", name)
+}
+
+func (n *BitcoinNetwork) String() string {
+	return n.Name
+}
+
+// DefaultCalendar returns the first default calendar server, or an error if
+// the network has none.
+func (n *BitcoinNetwork) DefaultCalendar() (string, error) {
+	if len(n.Calendars) == 0 {
+		return "", fmt.Errorf(
+			"no public calendars on %s, a calendar URL is required", n.Name,
+		)
+	}
+	return n.Calendars[0], nil
+}
+
+// A rawRequester sends arbitrary JSON-RPC requests. It is implemented by
+// *btcrpcclient.Client.
+type rawRequester interface {
+	RawRequest(method string, params []json.RawMessage) (json.RawMessage, error)
+}
+
+// A sourceWrapper is a header source built on another one, like a
+// HeaderCache or a SharedSource.
+type sourceWrapper interface {
+	unwrapSource() BlockHeaderSource
+}
+
+// findRawRequester returns the rawRequester of the source, looking through
+// wrapping sources, or nil if there is none.
+func findRawRequester(s BlockHeaderSource) rawRequester {
+	for {
+		if r, ok := s.(rawRequester); ok {
+			return r
+		}
+		w, ok := s.(sourceWrapper)
+		if !ok {
+			return nil
+		}
+		s = w.unwrapSource()
+	}
+}
+
+// Check returns an error if the header source follows another network.
+// Nodes are asked with getblockchaininfo, also through a HeaderCache or a
+// SharedSource, and the genesis block of every source is compared.
+func (n *BitcoinNetwork) Check(s BlockHeaderSource) error {
+	if r := findRawRequester(s); r != nil {
+		res, err := r.RawRequest("getblockchaininfo", nil)
+		if err != nil {
+			return err
+		}
+		var info struct {
+			Chain string `json:"chain"`
+		}
+		if err := json.Unmarshal(res, &info); err != nil {
+			return fmt.Errorf("invalid getblockchaininfo result: %v", err)
+		}
+		if info.Chain != n.Chain {
+			return fmt.Errorf(
+				"node is on chain %q, expected %q for %s",
+				info.Chain, n.Chain, n.Name,
+			)
+		}
+	}
+	genesis, err := s.GetBlockHash(0)
+	if err != nil {
+		return err
+	}
+	if !genesis.IsEqual(n.Params.GenesisHash) {
+		return fmt.Errorf(
+			"genesis block %v is not the one of %s", genesis, n.Name,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chainInfoSource answers getblockchaininfo with a fixed chain name
+type chainInfoSource struct {
+	*HeaderChain
+	chain string
+}
+
+func (c *chainInfoSource) RawRequest(
+	method string, params []json.RawMessage,
+) (json.RawMessage, error) {
+	return json.Marshal(map[string]string{"chain": c.chain})
+}
+
+func TestBitcoinNetworkByName(t *testing.T) {
+	for name, expected := range map[string]*BitcoinNetwork{
+		"mainnet": BitcoinMainnet,
+		"main":    BitcoinMainnet,
+		"Testnet": BitcoinTestnet,
+		"signet":  BitcoinSignet,
+		"regtest": BitcoinRegtest,
+	} {
+		n, err := BitcoinNetworkByName(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, n)
+	}
+	_, err := BitcoinNetworkByName("litecoin")
+	assert.Error(t, err)
+}
+
+func TestBitcoinNetworkDefaultCalendar(t *testing.T) {
+	calendar, err := BitcoinMainnet.DefaultCalendar()
+	require.NoError(t, err)
+	assert.Equal(t, BitcoinMainnet.Calendars[0], calendar)
+
+	_, err = BitcoinTestnet.DefaultCalendar()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "testnet")
+}
+
+func TestBitcoinNetworkCheck(t *testing.T) {
+	message := []byte("hello regtest")
+	digest := sha256.Sum256(message)
+	chain := NewHeaderChain(&chaincfg.RegressionNetParams)
+	_, err := chain.Connect(mineChain(
+		&chaincfg.RegressionNetParams.GenesisBlock.Header, 0, 10,
+		map[int64]chainhash.Hash{5: chainhash.Hash(digest)},
+	))
+	require.NoError(t, err)
+
+	assert.NoError(t, BitcoinRegtest.Check(chain))
+	err = BitcoinMainnet.Check(chain)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "genesis")
+
+	err = BitcoinRegtest.Check(&chainInfoSource{chain, "main"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `chain "main"`)
+	assert.NoError(t, BitcoinRegtest.Check(&chainInfoSource{chain, "regtest"}))
+
+	// the node is also asked through wrapping sources
+	node := &chainInfoSource{chain, "main"}
+	for _, s := range []BlockHeaderSource{
+		NewSharedSource(node, 0),
+		NewHeaderCache(NewSharedSource(node, 0), 10, 6),
+	} {
+		err = BitcoinRegtest.Check(s)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `chain "main"`)
+	}
+
+	// a mainnet proof is not verified against a regtest node
+	ts := newAttestedTimestamp(t, message, bitcoinTag, 5)
+	verifier := NewBitcoinAttestationVerifier(chain)
+	verifier.Network = BitcoinMainnet
+	_, err = verifier.Verify(ts)
+	assert.Error(t, err)
+	multi, err := NewMultiVerifier(verifier)
+	require.NoError(t, err)
+	report := multi.Report(ts)
+	assert.Nil(t, report.Time())
+
+	verifier.Network = BitcoinRegtest
+	verifiedTime, err := verifier.Verify(ts)
+	require.NoError(t, err)
+	assert.NotNil(t, verifiedTime)
+}
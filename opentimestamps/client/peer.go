@@ -0,0 +1,164 @@
+package client
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/go-socks/socks"
+)
+
+const (
+	// peerTimeout limits each read and write on a peer connection.
+	peerTimeout = 30 * time.Second
+	// minPeerProtocolVersion is the first protocol version with the
+	// getheaders message.
+	minPeerProtocolVersion = 31800
+	// maxIgnoredMessages is the number of unknown or unrelated messages
+	// accepted while waiting for a reply.
+	maxIgnoredMessages = 100
+)
+
+// peerConn exchanges bitcoin protocol messages over a connection
+type peerConn struct {
+	conn net.Conn
+	net  wire.BitcoinNet
+}
+
+func (p *peerConn) write(msg wire.Message) error {
+	p.conn.SetWriteDeadline(time.Now().Add(peerTimeout))
+	return wire.WriteMessage(p.conn, msg, wire.ProtocolVersion, p.net)
+}
+
+// read returns the next message accepted by f. Pings are answered, other
+// messages are skipped.
+func (p *peerConn) read(f func(wire.Message) bool) (wire.Message, error) {
+	for ignored := 0; ignored < maxIgnoredMessages; ignored++ {
+		p.conn.SetReadDeadline(time.Now().Add(peerTimeout))
+		msg, _, err := wire.ReadMessage(p.conn, wire.ProtocolVersion, p.net)
+		if _, ok := err.(*wire.MessageError); ok {
+			// unknown commands are discarded by the wire package
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ping, ok := msg.(*wire.MsgPing); ok {
+			if err := p.write(wire.NewMsgPong(ping.Nonce)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if f(msg) {
+			return msg, nil
+		}
+	}
+	return nil, fmt.Errorf("no reply after %d messages", maxIgnoredMessages)
+}
+
+// handshake exchanges version messages with the peer.
+func (p *peerConn) handshake(lastBlock int64) error {
+	you := &wire.NetAddress{Timestamp: time.Now()}
+	if addr, ok := p.conn.RemoteAddr().(*net.TCPAddr); ok {
+		you = wire.NewNetAddress(addr, 0)
+	}
+	version := wire.NewMsgVersion(
+		&wire.NetAddress{Timestamp: time.Now()}, you,
+		rand.Uint64(), int32(lastBlock),
+	)
+	version.DisableRelayTx = true
+	if err := p.write(version); err != nil {
+		return err
+	}
+
+	gotVersion, gotVerAck := false, false
+	for !gotVersion || !gotVerAck {
+		msg, err := p.read(func(msg wire.Message) bool {
+			switch msg.(type) {
+			case *wire.MsgVersion, *wire.MsgVerAck:
+				return true
+			}
+			return false
+		})
+		if err != nil {
+			return err
+		}
+		switch msg := msg.(type) {
+		case *wire.MsgVersion:
+			if msg.ProtocolVersion < minPeerProtocolVersion {
+				return fmt.Errorf(
+					"peer protocol version %d too old", msg.ProtocolVersion,
+				)
+			}
+			gotVersion = true
+			if err := p.write(wire.NewMsgVerAck()); err != nil {
+				return err
+			}
+		case *wire.MsgVerAck:
+			gotVerAck = true
+		}
+	}
+	return nil
+}
+
+// Sync downloads headers from a bitcoin peer over an established
+// connection until the peer has no more. It returns the number of blocks
+// added to the chain.
+func (c *HeaderChain) Sync(conn net.Conn) (int, error) {
+	p := &peerConn{conn: conn, net: c.params.Net}
+	if err := p.handshake(c.height()); err != nil {
+		return 0, fmt.Errorf("handshake with %v failed: %v", conn.RemoteAddr(), err)
+	}
+
+	added := 0
+	for {
+		getHeaders := wire.NewMsgGetHeaders()
+		for _, hash := range c.Locator() {
+			getHeaders.AddBlockLocatorHash(hash)
+		}
+		if err := p.write(getHeaders); err != nil {
+			return added, err
+		}
+		msg, err := p.read(func(msg wire.Message) bool {
+			_, ok := msg.(*wire.MsgHeaders)
+			return ok
+		})
+		if err != nil {
+			return added, err
+		}
+		headers := msg.(*wire.MsgHeaders).Headers
+		n, err := c.Connect(headers)
+		added += n
+		if err != nil {
+			return added, fmt.Errorf("bad headers from %v: %v", conn.RemoteAddr(), err)
+		}
+		if n == 0 || len(headers) < wire.MaxBlockHeadersPerMsg {
+			return added, nil
+		}
+	}
+}
+
+// SyncPeer connects to a bitcoin peer at the given address, like
+// "127.0.0.1:8333", and downloads its headers.
+func (c *HeaderChain) SyncPeer(addr string) (int, error) {
+	conn, err := net.DialTimeout("tcp", addr, peerTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return c.Sync(conn)
+}
+
+// SyncPeerProxy is like SyncPeer, but connects through a SOCKS5 proxy.
+func (c *HeaderChain) SyncPeerProxy(
+	addr string, proxy *socks.Proxy,
+) (int, error) {
+	conn, err := proxy.DialTimeout("tcp", addr, peerTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return c.Sync(conn)
+}
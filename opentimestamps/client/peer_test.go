@@ -0,0 +1,265 @@
+package client
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps/internal/socks5test"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/go-socks/socks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePeer is a regtest node serving a fixed chain of headers
+type fakePeer struct {
+	listener net.Listener
+	headers  []*wire.BlockHeader
+	// requests counts the getheaders messages received
+	requests int32
+}
+
+func newFakePeer(t *testing.T, headers []*wire.BlockHeader) *fakePeer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	p := &fakePeer{listener: l, headers: headers}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	return p
+}
+
+func (p *fakePeer) Addr() string {
+	return p.listener.Addr().String()
+}
+
+func (p *fakePeer) Close() {
+	p.listener.Close()
+}
+
+func (p *fakePeer) serve(conn net.Conn) {
+	defer conn.Close()
+	params := &chaincfg.RegressionNetParams
+	write := func(msg wire.Message) error {
+		return wire.WriteMessage(conn, msg, wire.ProtocolVersion, params.Net)
+	}
+	for {
+		msg, _, err := wire.ReadMessage(conn, wire.ProtocolVersion, params.Net)
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case *wire.MsgVersion:
+			version := wire.NewMsgVersion(
+				&wire.NetAddress{}, &wire.NetAddress{}, 1,
+				int32(len(p.headers)),
+			)
+			write(version)
+			// unrelated messages are skipped by the client
+			write(wire.NewMsgSendHeaders())
+			write(wire.NewMsgVerAck())
+		case *wire.MsgGetHeaders:
+			n := atomic.AddInt32(&p.requests, 1)
+			write(wire.NewMsgPing(uint64(n)))
+			reply := wire.NewMsgHeaders()
+			for _, h := range p.headersAfter(msg.BlockLocatorHashes) {
+				if len(reply.Headers) == wire.MaxBlockHeadersPerMsg {
+					break
+				}
+				reply.AddBlockHeader(h)
+			}
+			write(reply)
+		}
+	}
+}
+
+// headersAfter returns the headers following the first locator hash in the
+// chain.
+func (p *fakePeer) headersAfter(
+	locator []*chainhash.Hash,
+) []*wire.BlockHeader {
+	for _, hash := range locator {
+		if hash.IsEqual(chaincfg.RegressionNetParams.GenesisHash) {
+			return p.headers
+		}
+		for i, h := range p.headers {
+			if h.BlockHash() == *hash {
+				return p.headers[i+1:]
+			}
+		}
+	}
+	return nil
+}
+
+func TestHeaderChainSyncPeer(t *testing.T) {
+	message := []byte("hello peer")
+	digest := sha256.Sum256(message)
+	params := &chaincfg.RegressionNetParams
+	headers := mineChain(
+		&params.GenesisBlock.Header, 0, 2100,
+		map[int64]chainhash.Hash{100: chainhash.Hash(digest)},
+	)
+	peer := newFakePeer(t, headers)
+	defer peer.Close()
+
+	chain := NewHeaderChain(params)
+	n, err := chain.SyncPeer(peer.Addr())
+	require.NoError(t, err)
+	assert.Equal(t, 2100, n)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peer.requests))
+
+	n, err = chain.SyncPeer(peer.Addr())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	verifier := NewBitcoinAttestationVerifier(chain)
+	verifier.MinConfirmations = 6
+	results := verifier.BitcoinVerifications(
+		newAttestedTimestamp(t, message, bitcoinTag, 100),
+	)
+	require.Equal(t, 1, len(results))
+	require.NoError(t, results[0].Error)
+	assert.True(t, headers[99].Timestamp.Equal(*results[0].AttestationTime))
+	assert.Equal(t, int64(2001), results[0].Confirmations)
+}
+
+func TestHeaderChainSyncPeerProxy(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	headers := mineChain(&params.GenesisBlock.Header, 0, 10, nil)
+	peer := newFakePeer(t, headers)
+	defer peer.Close()
+	proxy, err := socks5test.NewServer("", "")
+	require.NoError(t, err)
+	defer proxy.Close()
+
+	chain := NewHeaderChain(params)
+	n, err := chain.SyncPeerProxy(peer.Addr(), &socks.Proxy{Addr: proxy.Addr()})
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, []string{peer.Addr()}, proxy.Targets())
+}
+
+func TestHeaderChainSyncInvalid(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	headers := mineChain(&params.GenesisBlock.Header, 0, 10, nil)
+	headers = append(headers, mineHeader(headers[9], chainhash.Hash{}, false))
+	peer := newFakePeer(t, headers)
+	defer peer.Close()
+
+	chain := NewHeaderChain(params)
+	n, err := chain.SyncPeer(peer.Addr())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "above target")
+	assert.Equal(t, 0, n)
+	count, _ := chain.GetBlockCount()
+	assert.Equal(t, int64(0), count)
+
+	// a peer of another network fails the handshake
+	chain = NewHeaderChain(&chaincfg.MainNetParams)
+	_, err = chain.SyncPeer(peer.Addr())
+	assert.Error(t, err)
+}
+
+func TestHeaderChainSyncLowWork(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	headers := mineChain(&params.GenesisBlock.Header, 0, 20, nil)
+	short := newFakePeer(t, headers[:10])
+	defer short.Close()
+	peer := newFakePeer(t, headers)
+	defer peer.Close()
+
+	// the genesis block and 15 blocks are needed
+	chain := NewHeaderChain(params)
+	chain.minWork = new(big.Int).Mul(
+		blockchain.CalcWork(params.PowLimitBits), big.NewInt(16),
+	)
+	n, err := chain.SyncPeer(short.Addr())
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	_, err = chain.GetBlockCount()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "below the minimum")
+	_, err = chain.GetBlockHash(5)
+	assert.Error(t, err)
+
+	n, err = chain.SyncPeer(peer.Addr())
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	count, err := chain.GetBlockCount()
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), count)
+}
+
+func TestHeaderChainSyncCheckpoint(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	genesis := &params.GenesisBlock.Header
+	headers := mineChain(genesis, 0, 10, nil)
+	checkpoint := headers[4].BlockHash()
+	params.Checkpoints = []chaincfg.Checkpoint{{Height: 5, Hash: &checkpoint}}
+
+	// a chain not matching the checkpoint is rejected
+	forged := mineChain(
+		genesis, 0, 10, map[int64]chainhash.Hash{3: chainhash.Hash{1}},
+	)
+	peer := newFakePeer(t, forged)
+	defer peer.Close()
+	chain := NewHeaderChain(&params)
+	_, err := chain.SyncPeer(peer.Addr())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match checkpoint")
+
+	// and so is a fork below the checkpoint, even with more work
+	n, err := chain.Connect(headers)
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	fork := mineChain(
+		headers[2], 3, 20, map[int64]chainhash.Hash{4: chainhash.Hash{1}},
+	)
+	_, err = chain.Connect(fork)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "below checkpoint at 5")
+	hash, err := chain.GetBlockHash(10)
+	require.NoError(t, err)
+	assert.Equal(t, headers[9].BlockHash(), *hash)
+
+	// forks above it are fine
+	n, err = chain.Connect(mineChain(
+		headers[5], 6, 10, map[int64]chainhash.Hash{7: chainhash.Hash{1}},
+	))
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+}
+
+func TestHeaderChainFutureTime(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	headers := mineChain(&params.GenesisBlock.Header, 0, 10, nil)
+	chain := NewHeaderChain(params)
+	chain.now = func() time.Time {
+		return headers[9].Timestamp
+	}
+	_, err := chain.Connect(headers)
+	require.NoError(t, err)
+
+	next := mineHeader(headers[9], chainhash.Hash{}, true)
+	next.Timestamp = headers[9].Timestamp.Add(3 * time.Hour)
+	_, err = chain.Connect([]*wire.BlockHeader{solveHeader(next, true)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "in the future")
+
+	next.Timestamp = headers[9].Timestamp.Add(time.Hour)
+	_, err = chain.Connect([]*wire.BlockHeader{solveHeader(next, true)})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,261 @@
+package client
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+)
+
+// AttestationKind returns the name used for an attestation type in a
+// VerificationPolicy. Attestations without a built-in name are identified by
+// their hex-encoded tag.
+func AttestationKind(a opentimestamps.Attestation) string {
+	switch a.(type) {
+	case *opentimestamps.BitcoinAttestation:
+		return "bitcoin"
+	case *opentimestamps.LitecoinAttestation:
+		return "litecoin"
+	case *opentimestamps.EthereumAttestation:
+		return "ethereum"
+	}
+	if _, ok := opentimestamps.PendingURI(a); ok {
+		return "pending"
+	}
+	return hex.EncodeToString(opentimestamps.AttestationTag(a))
+}
+
+// A VerificationPolicy decides whether a verification Report is acceptable.
+// The zero value of each field disables the respective rule.
+//
+// An attestation is trusted if it was verified, its block has at least
+// MinConfirmations confirmations and it relies on an acceptable calendar.
+// A report is acceptable if it has a trusted attestation for each required
+// kind, or no trusted attestation at all but pending attestations younger
+// than MaxPendingAge.
+type VerificationPolicy struct {
+	// MinConfirmations is the minimum depth of the attested block.
+	MinConfirmations int64
+	// RequiredAttestations maps attestation kinds, as returned by
+	// AttestationKind, to the number of trusted attestations of that kind
+	// from distinct calendars. Attestations without a calendar are
+	// distinct if they differ.
+	RequiredAttestations map[string]int
+	// AllowedCalendars are the only calendars attestations may rely on,
+	// if set.
+	AllowedCalendars []string
+	// BlockedCalendars are calendars attestations must not rely on.
+	BlockedCalendars []string
+	// MaxPendingAge is the maximum age of a timestamp that only has
+	// pending attestations. The age is taken from Report.PendingSince,
+	// which must be supplied by the caller since proofs don't record when
+	// they were created; pending timestamps of unknown age are rejected.
+	MaxPendingAge time.Duration
+	// FileHashOps are the accepted file hash operations, like SHA256.
+	FileHashOps []string
+}
+
+// policyFile is the JSON representation of a VerificationPolicy
+type policyFile struct {
+	MinConfirmations     int64          `json:"min_confirmations"`
+	RequiredAttestations map[string]int `json:"required_attestations"`
+	AllowedCalendars     []string       `json:"allowed_calendars"`
+	BlockedCalendars     []string       `json:"blocked_calendars"`
+	MaxPendingAge        string         `json:"max_pending_age"`
+	FileHashOps          []string       `json:"file_hash_ops"`
+}
+
+// ReadVerificationPolicy decodes a VerificationPolicy from JSON, like
+//
+//	{
+//	  "min_confirmations": 6,
+//	  "required_attestations": {"bitcoin": 2},
+//	  "blocked_calendars": ["https://calendar.example.org"],
+//	  "max_pending_age": "24h",
+//	  "file_hash_ops": ["SHA256"]
+//	}
+//
+// The age checked against max_pending_age is measured from
+// Report.PendingSince. gots-verify only sets it from the -pending-since
+// flag, not from the proof file's modification time, which copying or
+// touching the file would change.
+func ReadVerificationPolicy(r io.Reader) (*VerificationPolicy, error) {
+	var f policyFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("error decoding policy: %v", err)
+	}
+	p := &VerificationPolicy{
+		MinConfirmations:     f.MinConfirmations,
+		RequiredAttestations: f.RequiredAttestations,
+		AllowedCalendars:     f.AllowedCalendars,
+		BlockedCalendars:     f.BlockedCalendars,
+		FileHashOps:          f.FileHashOps,
+	}
+	if f.MaxPendingAge != "" {
+		d, err := time.ParseDuration(f.MaxPendingAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_pending_age: %v", err)
+		}
+		p.MaxPendingAge = d
+	}
+	for kind, n := range p.RequiredAttestations {
+		if n < 0 {
+			return nil, fmt.Errorf("negative count for %q", kind)
+		}
+	}
+	return p, nil
+}
+
+// LoadVerificationPolicy reads a JSON policy file.
+func LoadVerificationPolicy(path string) (*VerificationPolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadVerificationPolicy(f)
+}
+
+// A PolicyVerdict is the outcome of evaluating a VerificationPolicy.
+type PolicyVerdict struct {
+	// Trusted are the attestation results accepted by the policy.
+	Trusted []AttestationResult
+	// Pending is true if the report was accepted because of young pending
+	// attestations.
+	Pending bool
+	// Violations describe why the report was rejected.
+	Violations []string
+}
+
+// Time returns the earliest trusted attestation time, or nil if there is
+// none.
+func (v *PolicyVerdict) Time() *time.Time {
+	return (&Report{Results: v.Trusted}).Time()
+}
+
+// Err returns an error listing the violations, or nil if the report was
+// accepted.
+func (v *PolicyVerdict) Err() error {
+	if len(v.Violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("policy violated: %s", strings.Join(v.Violations, "; "))
+}
+
+func normalizeCalendar(uri string) string {
+	return strings.TrimRight(uri, "/")
+}
+
+func containsCalendar(calendars []string, uri string) bool {
+	for _, c := range calendars {
+		if normalizeCalendar(c) == normalizeCalendar(uri) {
+			return true
+		}
+	}
+	return false
+}
+
+// calendarAllowed returns true if an attestation relying on the calendar
+// may be trusted. An empty calendar is only allowed if AllowedCalendars is
+// not set.
+func (p *VerificationPolicy) calendarAllowed(uri string) bool {
+	if containsCalendar(p.BlockedCalendars, uri) {
+		return false
+	}
+	return len(p.AllowedCalendars) == 0 ||
+		containsCalendar(p.AllowedCalendars, uri)
+}
+
+func (p *VerificationPolicy) fileHashOpAllowed(name string) bool {
+	if len(p.FileHashOps) == 0 {
+		return true
+	}
+	for _, op := range p.FileHashOps {
+		if strings.EqualFold(op, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate applies the policy to a report. The current time now is used to
+// determine the age of pending attestations.
+func (p *VerificationPolicy) Evaluate(r *Report, now time.Time) *PolicyVerdict {
+	v := &PolicyVerdict{}
+	violate := func(format string, args ...interface{}) {
+		v.Violations = append(v.Violations, fmt.Sprintf(format, args...))
+	}
+
+	if !p.fileHashOpAllowed(r.FileHashOp) {
+		violate("file hash op %q not allowed", r.FileHashOp)
+	}
+
+	pending := 0
+	for _, res := range r.Results {
+		if !p.calendarAllowed(res.Calendar) {
+			continue
+		}
+		if _, ok := opentimestamps.PendingURI(res.Attestation); ok {
+			pending += 1
+			continue
+		}
+		if !res.Verified() || res.Confirmations < p.MinConfirmations {
+			continue
+		}
+		v.Trusted = append(v.Trusted, res)
+	}
+
+	if len(v.Trusted) == 0 {
+		if p.MaxPendingAge > 0 && pending > 0 {
+			if r.PendingSince == nil {
+				violate("pending since an unknown time")
+				return v
+			}
+			age := now.Sub(*r.PendingSince)
+			if age <= p.MaxPendingAge {
+				v.Pending = true
+				return v
+			}
+			violate("pending for %v, over %v", age, p.MaxPendingAge)
+		}
+		violate("no trusted attestation")
+		return v
+	}
+
+	// attestations are independent if they come from different calendars,
+	// even if they are in the same block
+	distinct := map[string]map[string]bool{}
+	for _, res := range v.Trusted {
+		kind := AttestationKind(res.Attestation)
+		if distinct[kind] == nil {
+			distinct[kind] = map[string]bool{}
+		}
+		key := strings.TrimRight(res.Calendar, "/")
+		if key == "" {
+			key = fmt.Sprint(res.Attestation)
+		}
+		distinct[kind][key] = true
+	}
+	var kinds []string
+	for kind := range p.RequiredAttestations {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		if n := p.RequiredAttestations[kind]; len(distinct[kind]) < n {
+			violate(
+				"%d trusted %s attestations, %d required",
+				len(distinct[kind]), kind, n,
+			)
+		}
+	}
+	return v
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	pendingTag = "83dfe30d2ef90c8e"
+	calendarA  = "https://a.example.org"
+	calendarB  = "https://b.example.org"
+)
+
+func rawPendingAttestation(t *testing.T, uri string) []byte {
+	return rawAttestation(
+		t, pendingTag, append([]byte{byte(len(uri))}, uri...),
+	)
+}
+
+// newCalendarBranch returns a timestamp node with a pending attestation for
+// the calendar and a bitcoin attestation at the given height below it.
+func newCalendarBranch(t *testing.T, calendar string, height byte) []byte {
+	raw := []byte{0xff}
+	raw = append(raw, rawPendingAttestation(t, calendar)...)
+	raw = append(raw, 0x08)
+	return append(raw, rawAttestation(t, bitcoinTag, []byte{height})...)
+}
+
+// newPolicyTestReport returns a report for a timestamp with two bitcoin
+// attestations at heights 100 and 101, obtained from calendarA and
+// calendarB. The best block is at height 105.
+func newPolicyTestReport(t *testing.T) *Report {
+	raw := []byte{0xff, 0x08}
+	raw = append(raw, newCalendarBranch(t, calendarA, 100)...)
+	raw = append(raw, 0xf0, 0x01, 'b', 0x08)
+	raw = append(raw, newCalendarBranch(t, calendarB, 101)...)
+	return newPolicyReport(t, raw, []byte("hello policy"))
+}
+
+// newPolicyReport returns a report for the encoded timestamp, with blocks
+// matching its bitcoin attestations. The best block is at height 105.
+func newPolicyReport(t *testing.T, raw, message []byte) *Report {
+	ts, err := opentimestamps.NewTimestampFromReader(
+		bytes.NewReader(raw), message,
+	)
+	require.NoError(t, err)
+
+	source := newFakeHeaderSource()
+	source.add(105, &wire.BlockHeader{})
+	blockTime := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts.Walk(func(ts *opentimestamps.Timestamp) {
+		for _, att := range ts.Attestations {
+			if btcAtt, ok := att.(*opentimestamps.BitcoinAttestation); ok {
+				merkleRoot, err := chainhash.NewHash(ts.Message)
+				require.NoError(t, err)
+				source.add(int64(btcAtt.Height), &wire.BlockHeader{
+					MerkleRoot: *merkleRoot,
+					Timestamp:  blockTime.Add(time.Duration(btcAtt.Height)),
+				})
+			}
+		}
+	})
+	source.fill(105)
+	verifier, err := NewMultiVerifier(NewBitcoinAttestationVerifier(source))
+	require.NoError(t, err)
+	report := verifier.Report(ts)
+	report.FileHashOp = "SHA256"
+	return report
+}
+
+func TestReportCalendarsAndConfirmations(t *testing.T) {
+	report := newPolicyTestReport(t)
+	require.Equal(t, 4, len(report.Results))
+	for _, res := range report.Results {
+		if btcAtt, ok := res.Attestation.(*opentimestamps.BitcoinAttestation); ok {
+			require.NoError(t, res.Error)
+			assert.Equal(t, int64(106-btcAtt.Height), res.Confirmations)
+			if btcAtt.Height == 100 {
+				assert.Equal(t, calendarA, res.Calendar)
+			} else {
+				assert.Equal(t, calendarB, res.Calendar)
+			}
+		}
+	}
+}
+
+func TestVerificationPolicy(t *testing.T) {
+	report := newPolicyTestReport(t)
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name       string
+		policy     VerificationPolicy
+		trusted    int
+		violations int
+	}{
+		{"empty", VerificationPolicy{}, 2, 0},
+		{"confirmations", VerificationPolicy{MinConfirmations: 6}, 1, 0},
+		{"too few confirmations", VerificationPolicy{MinConfirmations: 7}, 0, 1},
+		{"two bitcoin", VerificationPolicy{
+			RequiredAttestations: map[string]int{"bitcoin": 2},
+		}, 2, 0},
+		{"blocked calendar", VerificationPolicy{
+			RequiredAttestations: map[string]int{"bitcoin": 2},
+			BlockedCalendars:     []string{calendarB + "/"},
+		}, 1, 1},
+		{"allowed calendar", VerificationPolicy{
+			AllowedCalendars: []string{calendarA},
+		}, 1, 0},
+		{"missing kinds", VerificationPolicy{
+			RequiredAttestations: map[string]int{"litecoin": 1, "ethereum": 1},
+		}, 2, 2},
+		{"file hash op", VerificationPolicy{
+			FileHashOps: []string{"SHA1", "sha256"},
+		}, 2, 0},
+		{"file hash op not allowed", VerificationPolicy{
+			FileHashOps: []string{"SHA1"},
+		}, 2, 1},
+	} {
+		verdict := tc.policy.Evaluate(report, now)
+		assert.Equal(t, tc.trusted, len(verdict.Trusted), tc.name)
+		assert.Equal(t, tc.violations, len(verdict.Violations), tc.name)
+		assert.Equal(t, tc.violations == 0, verdict.Err() == nil, tc.name)
+		assert.False(t, verdict.Pending, tc.name)
+	}
+
+	verdict := (&VerificationPolicy{MinConfirmations: 6}).Evaluate(report, now)
+	assert.Equal(t, report.Results[1].AttestationTime, verdict.Time())
+}
+
+func TestVerificationPolicySameBlock(t *testing.T) {
+	// calendarA and calendarB commit to a and b, which are merkle-hashed
+	// into the same block
+	message := []byte("hello same block")
+	a := sha256.Sum256(append(append([]byte{}, message...), 'a'))
+	b := sha256.Sum256(append(append([]byte{}, message...), 'b'))
+	branch := func(calendar string, suffix byte, op byte, sibling []byte) []byte {
+		raw := []byte{0xf0, 0x01, suffix, 0xff}
+		raw = append(raw, rawPendingAttestation(t, calendar)...)
+		raw = append(raw, 0x08, op, byte(len(sibling)))
+		raw = append(raw, sibling...)
+		raw = append(raw, 0x08)
+		return append(raw, rawAttestation(t, bitcoinTag, []byte{100})...)
+	}
+	raw := []byte{0xff}
+	raw = append(raw, branch(calendarA, 'a', 0xf0, b[:])...)
+	raw = append(raw, branch(calendarB, 'b', 0xf1, a[:])...)
+	report := newPolicyReport(t, raw, message)
+
+	policy := &VerificationPolicy{
+		RequiredAttestations: map[string]int{"bitcoin": 2},
+	}
+	verdict := policy.Evaluate(report, time.Now())
+	require.NoError(t, verdict.Err())
+	require.Equal(t, 2, len(verdict.Trusted))
+	assert.Equal(
+		t, verdict.Trusted[0].Attestation, verdict.Trusted[1].Attestation,
+	)
+
+	// a single calendar is not enough
+	policy.AllowedCalendars = []string{calendarA}
+	assert.Error(t, policy.Evaluate(report, time.Now()).Err())
+}
+
+func TestVerificationPolicyPending(t *testing.T) {
+	ts, err := opentimestamps.NewTimestampFromReader(
+		bytes.NewReader(rawPendingAttestation(t, calendarA)),
+		[]byte("hello pending"),
+	)
+	require.NoError(t, err)
+	verifier, err := NewMultiVerifier()
+	require.NoError(t, err)
+	report := verifier.Report(ts)
+
+	now := time.Now()
+	policy := &VerificationPolicy{MaxPendingAge: 2 * time.Hour}
+	err = policy.Evaluate(report, now).Err()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown time")
+
+	since := now.Add(-time.Hour)
+	report.PendingSince = &since
+	verdict := policy.Evaluate(report, now)
+	assert.NoError(t, verdict.Err())
+	assert.True(t, verdict.Pending)
+	assert.Nil(t, verdict.Time())
+
+	policy.MaxPendingAge = 30 * time.Minute
+	assert.Error(t, policy.Evaluate(report, now).Err())
+
+	policy.MaxPendingAge = 2 * time.Hour
+	policy.BlockedCalendars = []string{calendarA}
+	assert.Error(t, policy.Evaluate(report, now).Err())
+}
+
+func TestReadVerificationPolicy(t *testing.T) {
+	policy, err := ReadVerificationPolicy(strings.NewReader(`{
+		"min_confirmations": 6,
+		"required_attestations": {"bitcoin": 2},
+		"allowed_calendars": ["https://a.example.org"],
+		"blocked_calendars": ["https://b.example.org"],
+		"max_pending_age": "24h",
+		"file_hash_ops": ["SHA256"]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, &VerificationPolicy{
+		MinConfirmations:     6,
+		RequiredAttestations: map[string]int{"bitcoin": 2},
+		AllowedCalendars:     []string{calendarA},
+		BlockedCalendars:     []string{calendarB},
+		MaxPendingAge:        24 * time.Hour,
+		FileHashOps:          []string{"SHA256"},
+	}, policy)
+
+	for _, in := range []string{
+		`{"min_confirmation": 6}`,
+		`{"max_pending_age": "1 day"}`,
+		`{"required_attestations": {"bitcoin": -1}}`,
+		`[]`,
+	} {
+		_, err := ReadVerificationPolicy(strings.NewReader(in))
+		assert.Error(t, err, in)
+	}
+}
@@ -0,0 +1,402 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+)
+
+// A Verifier verifies the attestations of a single type, identified by the
+// attestation tag. Implementing it is all that is needed to support a new
+// notary in a MultiVerifier.
+type Verifier interface {
+	// AttestationTag returns the tag of the attestations the Verifier
+	// handles.
+	AttestationTag() []byte
+	// CheckAttestation verifies the attestation against the digest it
+	// commits to. It returns the attested time if the verification
+	// succeeds, an error otherwise.
+	CheckAttestation(
+		digest []byte, a opentimestamps.Attestation,
+	) (*time.Time, error)
+}
+
+// A ConfirmationCounter is a Verifier that can tell how deep the block of an
+// attestation is buried in the best chain.
+type ConfirmationCounter interface {
+	Confirmations(a opentimestamps.Attestation) (int64, error)
+}
+
+// A VerifiedBlock describes the block an attestation was verified against.
+type VerifiedBlock struct {
+	Time time.Time
+	// Hash is the block hash in the byte order used by the node's RPC
+	// interface.
+	Hash string
+	// Confirmations is the depth of the block, or zero if unknown.
+	Confirmations int64
+	// Warning is set if the block was accepted with reservations, like too
+	// few confirmations.
+	Warning error
+	// Interval bounds the block creation time, if known.
+	Interval *TimeInterval
+}
+
+// A BlockVerifier is a Verifier for block attestations that also reports the
+// block used for the verification.
+type BlockVerifier interface {
+	Verifier
+	CheckBlock(
+		digest []byte, a opentimestamps.Attestation,
+	) (*VerifiedBlock, error)
+}
+
+// unexpectedAttestation is returned by the CheckAttestation methods when
+// they are passed an attestation of the wrong type.
+func unexpectedAttestation(
+	v Verifier, a opentimestamps.Attestation,
+) error {
+	return fmt.Errorf("%T cannot verify %T", v, a)
+}
+
+func (v *BitcoinAttestationVerifier) AttestationTag() []byte {
+	return opentimestamps.BitcoinAttestationTag
+}
+
+func (v *BitcoinAttestationVerifier) CheckAttestation(
+	digest []byte, a opentimestamps.Attestation,
+) (*time.Time, error) {
+	btcAtt, ok := a.(*opentimestamps.BitcoinAttestation)
+	if !ok {
+		return nil, unexpectedAttestation(v, a)
+	}
+	return v.VerifyAttestation(digest, btcAtt)
+}
+
+func (v *BitcoinAttestationVerifier) CheckBlock(
+	digest []byte, a opentimestamps.Attestation,
+) (*VerifiedBlock, error) {
+	btcAtt, ok := a.(*opentimestamps.BitcoinAttestation)
+	if !ok {
+		return nil, unexpectedAttestation(v, a)
+	}
+	block, warning, err := v.VerifyAttestationBlock(digest, btcAtt)
+	if err != nil {
+		return nil, err
+	}
+	res := &VerifiedBlock{
+		Time:          block.Header.Timestamp.UTC(),
+		Hash:          block.Hash.String(),
+		Confirmations: block.Confirmations,
+		Warning:       warning,
+	}
+	if v.TimeBounds {
+		interval := block.Interval()
+		res.Interval = &interval
+	}
+	return res, nil
+}
+
+// Confirmations returns the number of blocks on top of and including the
+// attested block. The header source must implement BlockCountSource.
+func (v *BitcoinAttestationVerifier) Confirmations(
+	a opentimestamps.Attestation,
+) (int64, error) {
+	btcAtt, ok := a.(*opentimestamps.BitcoinAttestation)
+	if !ok {
+		return 0, unexpectedAttestation(v, a)
+	}
+	if err := v.checkNetwork(); err != nil {
+		return 0, err
+	}
+	return blockConfirmations(v.btcrpcClient, btcAtt.Height)
+}
+
+func (v *LitecoinAttestationVerifier) AttestationTag() []byte {
+	return opentimestamps.LitecoinAttestationTag
+}
+
+func (v *LitecoinAttestationVerifier) CheckAttestation(
+	digest []byte, a opentimestamps.Attestation,
+) (*time.Time, error) {
+	ltcAtt, ok := a.(*opentimestamps.LitecoinAttestation)
+	if !ok {
+		return nil, unexpectedAttestation(v, a)
+	}
+	return v.VerifyAttestation(digest, ltcAtt)
+}
+
+// Confirmations returns the number of blocks on top of and including the
+// attested block. The header source must implement BlockCountSource.
+func (v *LitecoinAttestationVerifier) Confirmations(
+	a opentimestamps.Attestation,
+) (int64, error) {
+	ltcAtt, ok := a.(*opentimestamps.LitecoinAttestation)
+	if !ok {
+		return 0, unexpectedAttestation(v, a)
+	}
+	return blockConfirmations(v.source, ltcAtt.Height)
+}
+
+func (v *EthereumAttestationVerifier) AttestationTag() []byte {
+	return opentimestamps.EthereumAttestationTag
+}
+
+func (v *EthereumAttestationVerifier) CheckAttestation(
+	digest []byte, a opentimestamps.Attestation,
+) (*time.Time, error) {
+	ethAtt, ok := a.(*opentimestamps.EthereumAttestation)
+	if !ok {
+		return nil, unexpectedAttestation(v, a)
+	}
+	return v.VerifyAttestation(digest, ethAtt)
+}
+
+// Confirmations returns the number of blocks on top of and including the
+// attested block. The header source must implement
+// EthereumBlockNumberSource.
+func (v *EthereumAttestationVerifier) Confirmations(
+	a opentimestamps.Attestation,
+) (int64, error) {
+	ethAtt, ok := a.(*opentimestamps.EthereumAttestation)
+	if !ok {
+		return 0, unexpectedAttestation(v, a)
+	}
+	s, ok := v.source.(EthereumBlockNumberSource)
+	if !ok {
+		return 0, fmt.Errorf("%T cannot report the block number", v.source)
+	}
+	number, err := s.BlockNumber()
+	if err != nil {
+		return 0, err
+	}
+	if ethAtt.Height > number || number-ethAtt.Height >= math.MaxInt64 {
+		return 0, fmt.Errorf(
+			"block number %d above best block %d", ethAtt.Height, number,
+		)
+	}
+	return int64(number-ethAtt.Height) + 1, nil
+}
+
+// An AttestationResult is the result of checking a single attestation. The
+// Verifier is nil if none was registered for the attestation tag.
+type AttestationResult struct {
+	Timestamp       *opentimestamps.Timestamp
+	Attestation     opentimestamps.Attestation
+	Verifier        Verifier
+	AttestationTime *time.Time
+	Error           error
+	// Confirmations is the depth of the attested block, or zero if unknown.
+	Confirmations int64
+	// Calendar is the URI of the closest pending attestation on the path
+	// to the attestation, or empty if there is none.
+	Calendar string
+	// BlockHash, Warning and Interval are set by a BlockVerifier.
+	BlockHash string
+	Warning   error
+	Interval  *TimeInterval
+}
+
+// Verified returns true if the attestation was checked successfully.
+func (r *AttestationResult) Verified() bool {
+	return r.Verifier != nil && r.Error == nil
+}
+
+// A Report contains the results for all attestations of a timestamp.
+type Report struct {
+	Results []AttestationResult
+	// FileHashOp is the name of the file hash operation, if the report
+	// was created for a DetachedTimestamp.
+	FileHashOp string
+	// PendingSince is the time the pending attestations were obtained, if
+	// known. It is used to determine the age of pending timestamps.
+	PendingSince *time.Time
+}
+
+// Time returns the earliest verified attestation time, or nil if no
+// attestation was verified.
+func (r *Report) Time() (ret *time.Time) {
+	for i := range r.Results {
+		res := &r.Results[i]
+		if !res.Verified() {
+			continue
+		}
+		if ret == nil || res.AttestationTime.Before(*ret) {
+			ret = res.AttestationTime
+		}
+	}
+	return
+}
+
+// Interval returns the time interval of the verified attestation with the
+// earliest upper bound, or nil if no verified attestation has an interval.
+func (r *Report) Interval() (ret *TimeInterval) {
+	for i := range r.Results {
+		res := &r.Results[i]
+		if !res.Verified() || res.Interval == nil {
+			continue
+		}
+		if ret == nil || res.Interval.Latest.Before(ret.Latest) {
+			ret = res.Interval
+		}
+	}
+	return
+}
+
+// Err returns the last verification error, or nil if all checked
+// attestations were verified.
+func (r *Report) Err() (err error) {
+	for _, res := range r.Results {
+		if res.Error != nil {
+			err = res.Error
+		}
+	}
+	return
+}
+
+// Unverified returns the attestations without a registered Verifier, like
+// pending attestations.
+func (r *Report) Unverified() (res []opentimestamps.Attestation) {
+	for _, result := range r.Results {
+		if result.Verifier == nil {
+			res = append(res, result.Attestation)
+		}
+	}
+	return
+}
+
+// A MultiVerifier dispatches each attestation of a timestamp to the Verifier
+// registered for its tag.
+type MultiVerifier struct {
+	mu        sync.RWMutex
+	verifiers map[string]Verifier
+}
+
+// NewMultiVerifier returns a MultiVerifier with the given verifiers
+// registered. It returns an error if two verifiers share a tag.
+func NewMultiVerifier(verifiers ...Verifier) (*MultiVerifier, error) {
+	m := &MultiVerifier{verifiers: map[string]Verifier{}}
+	for _, v := range verifiers {
+		if err := m.Register(v); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Register adds a Verifier. It returns an error if a Verifier for the same
+// attestation tag is already registered.
+func (m *MultiVerifier) Register(v Verifier) error {
+	tag := string(v.AttestationTag())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if prev, ok := m.verifiers[tag]; ok {
+		return fmt.Errorf(
+			"attestation tag %x already handled by %T", tag, prev,
+		)
+	}
+	m.verifiers[tag] = v
+	return nil
+}
+
+func (m *MultiVerifier) verifier(a opentimestamps.Attestation) Verifier {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.verifiers[string(opentimestamps.AttestationTag(a))]
+}
+
+// pathCalendar returns the URI of the last pending attestation in path
+func pathCalendar(path []*opentimestamps.Timestamp) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		for _, att := range path[i].Attestations {
+			if uri, ok := opentimestamps.PendingURI(att); ok {
+				return uri
+			}
+		}
+	}
+	return ""
+}
+
+// checkAttestation fills in the verification result of res
+func checkAttestation(res AttestationResult) AttestationResult {
+	digest, att := res.Timestamp.Message, res.Attestation
+	switch v := res.Verifier.(type) {
+	case nil:
+	case BlockVerifier:
+		block, err := v.CheckBlock(digest, att)
+		if err != nil {
+			res.Error = err
+			break
+		}
+		res.AttestationTime = &block.Time
+		res.BlockHash = block.Hash
+		res.Confirmations = block.Confirmations
+		res.Warning = block.Warning
+		res.Interval = block.Interval
+	default:
+		res.AttestationTime, res.Error = v.CheckAttestation(digest, att)
+		if c, ok := v.(ConfirmationCounter); ok && res.Error == nil {
+			// unknown confirmations are reported as zero
+			res.Confirmations, _ = c.Confirmations(att)
+		}
+	}
+	return res
+}
+
+// Warnings returns the warnings of all verified attestations.
+func (r *Report) Warnings() (res []error) {
+	for _, result := range r.Results {
+		if result.Warning != nil {
+			res = append(res, result.Warning)
+		}
+	}
+	return
+}
+
+// Report walks the timestamp once and checks every attestation with the
+// Verifier registered for its tag. If the Verifier is a ConfirmationCounter,
+// the confirmations of verified attestations are reported as well, and if it
+// is a BlockVerifier, the block hash and warnings.
+func (m *MultiVerifier) Report(t *opentimestamps.Timestamp) *Report {
+	report := &Report{}
+	t.WalkPath(func(
+		ts *opentimestamps.Timestamp, path []*opentimestamps.Timestamp,
+	) {
+		calendar := pathCalendar(append(path, ts))
+		for _, att := range ts.Attestations {
+			res := AttestationResult{
+				Timestamp:   ts,
+				Attestation: att,
+				Verifier:    m.verifier(att),
+				Calendar:    calendar,
+			}
+			if uri, ok := opentimestamps.PendingURI(att); ok {
+				res.Calendar = uri
+			}
+			report.Results = append(report.Results, checkAttestation(res))
+		}
+	})
+	return report
+}
+
+// ReportDetached is like Report, but also records the file hash operation of
+// the detached timestamp.
+func (m *MultiVerifier) ReportDetached(
+	d *opentimestamps.DetachedTimestamp,
+) *Report {
+	report := m.Report(d.Timestamp)
+	report.FileHashOp = d.HashOpName()
+	return report
+}
+
+// Verify returns the earliest attested time over all registered verifiers,
+// or nil if none can be found or verified successfully.
+func (m *MultiVerifier) Verify(
+	t *opentimestamps.Timestamp,
+) (*time.Time, error) {
+	report := m.Report(t)
+	return report.Time(), report.Err()
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/BlockchainSource/go-opentimestamps/opentimestamps"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rawAttestation returns an encoded attestation with a varuint payload
+func rawAttestation(t *testing.T, tag string, payload []byte) []byte {
+	tagBytes, err := hex.DecodeString(tag)
+	require.NoError(t, err)
+	raw := append([]byte{0x00}, tagBytes...)
+	raw = append(raw, byte(len(payload)))
+	return append(raw, payload...)
+}
+
+// newForkedTimestamp returns a timestamp that hashes the message with
+// SHA256 and has all given attestations on the result.
+func newForkedTimestamp(
+	t *testing.T, message []byte, atts ...[]byte,
+) *opentimestamps.Timestamp {
+	raw := []byte{0x08}
+	for i, att := range atts {
+		if i < len(atts)-1 {
+			raw = append(raw, 0xff)
+		}
+		raw = append(raw, att...)
+	}
+	ts, err := opentimestamps.NewTimestampFromReader(
+		bytes.NewReader(raw), message,
+	)
+	require.NoError(t, err)
+	return ts
+}
+
+// fixedVerifier is a Verifier for a custom tag that returns a fixed result
+type fixedVerifier struct {
+	tag  []byte
+	time time.Time
+	err  error
+}
+
+func (f *fixedVerifier) AttestationTag() []byte {
+	return f.tag
+}
+
+func (f *fixedVerifier) CheckAttestation(
+	digest []byte, a opentimestamps.Attestation,
+) (*time.Time, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &f.time, nil
+}
+
+func TestMultiVerifier(t *testing.T) {
+	message := []byte("hello multiverifier")
+	digest := sha256.Sum256(message)
+	ltcTime := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	btcTime := ltcTime.Add(time.Hour)
+	customTime := ltcTime.Add(-time.Hour)
+
+	btcSource := newFakeHeaderSource()
+	btcSource.add(100, &wire.BlockHeader{
+		MerkleRoot: chainhash.Hash(digest),
+		Timestamp:  btcTime,
+	})
+	btcSource.fill(100)
+	ltcSource := newFakeHeaderSource()
+	ltcSource.add(100, &wire.BlockHeader{
+		MerkleRoot: chainhash.Hash(digest),
+		Timestamp:  ltcTime,
+	})
+
+	customTag := "ee00000000000001"
+	custom := &fixedVerifier{tag: mustDecodeHex(customTag), time: customTime}
+	verifier, err := NewMultiVerifier(
+		NewBitcoinAttestationVerifier(btcSource),
+		NewLitecoinAttestationVerifier(ltcSource),
+	)
+	require.NoError(t, err)
+
+	ts := newForkedTimestamp(t, message,
+		rawAttestation(t, bitcoinTag, []byte{100}),
+		rawAttestation(t, litecoinTag, []byte{100}),
+		rawAttestation(t, customTag, []byte{0x01}),
+		rawAttestation(t, "83dfe30d2ef90c8e", append(
+			[]byte{0x13}, "https://example.org"...,
+		)),
+	)
+
+	report := verifier.Report(ts)
+	require.Equal(t, 4, len(report.Results))
+	assert.NoError(t, report.Err())
+	assert.Equal(t, ltcTime, *report.Time())
+	assert.Equal(t, 2, len(report.Unverified()))
+
+	// a custom verifier only requires the interface
+	require.NoError(t, verifier.Register(custom))
+	verifiedTime, err := verifier.Verify(ts)
+	require.NoError(t, err)
+	assert.Equal(t, customTime, *verifiedTime)
+	assert.Equal(t, 1, len(verifier.Report(ts).Unverified()))
+
+	// failures are reported, but don't hide the verified times
+	custom.err = fmt.Errorf("bad signature")
+	verifiedTime, err = verifier.Verify(ts)
+	assert.Equal(t, custom.err, err)
+	assert.Equal(t, ltcTime, *verifiedTime)
+
+	assert.Error(t, verifier.Register(NewBitcoinAttestationVerifier(btcSource)))
+	_, err = NewMultiVerifier(custom, custom)
+	assert.Error(t, err)
+}
+
+func mustDecodeHex(in string) []byte {
+	out, err := hex.DecodeString(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
@@ -0,0 +1,130 @@
+package opentimestamps
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// DecodeOptions control the resource limits and the strictness of the
+// parser. A zero limit disables the respective check.
+type DecodeOptions struct {
+	// MaxDepth limits the nesting depth of operations.
+	MaxDepth int
+	// MaxNodes limits the total number of timestamp nodes.
+	MaxNodes int
+	// MaxBytes limits the total number of bytes read from the input.
+	MaxBytes int64
+	// MaxAttestations limits the total number of attestations.
+	MaxAttestations int
+	// StrictEOF rejects trailing data after the timestamp.
+	StrictEOF bool
+	// RejectNonCanonical rejects non-minimal varuint encodings as well as
+	// attestations and operations that are not in canonical order.
+	RejectNonCanonical bool
+	// EnforceResultLength rejects operations with results longer than
+	// maxResultLength.
+	EnforceResultLength bool
+	// Unbuffered disables wrapping readers that don't implement
+	// io.ByteReader in a bufio.Reader. No bytes past the end of the
+	// timestamp are consumed then, at the cost of a Read call per byte.
+	Unbuffered bool
+}
+
+// DefaultDecodeOptions are lenient and used by NewTimestampFromReader and
+// NewDetachedTimestampFromReader.
+var DefaultDecodeOptions = DecodeOptions{
+	MaxDepth: 1000,
+}
+
+// StrictDecodeOptions are suitable for parsing untrusted input.
+var StrictDecodeOptions = DecodeOptions{
+	MaxDepth:            256,
+	MaxNodes:            100000,
+	MaxBytes:            1 << 20,
+	MaxAttestations:     1000,
+	StrictEOF:           true,
+	RejectNonCanonical:  true,
+	EnforceResultLength: true,
+}
+
+// decodeState tracks the resources consumed while parsing a timestamp.
+type decodeState struct {
+	nodes        int
+	attestations int
+}
+
+func (d *deserializationContext) addNode() error {
+	d.state.nodes += 1
+	if max := d.opts.MaxNodes; max > 0 && d.state.nodes > max {
+		return fmt.Errorf("over node limit: %d", max)
+	}
+	return nil
+}
+
+func (d *deserializationContext) addAttestation() error {
+	d.state.attestations += 1
+	if max := d.opts.MaxAttestations; max > 0 && d.state.attestations > max {
+		return fmt.Errorf("over attestation limit: %d", max)
+	}
+	return nil
+}
+
+// checkResultLength returns an error if the result of an operation exceeds
+// maxResultLength and EnforceResultLength is set.
+func (d *deserializationContext) checkResultLength(res []byte) error {
+	if d.opts.EnforceResultLength && len(res) > maxResultLength {
+		return fmt.Errorf(
+			"op result length %d over maxResultLength %d",
+			len(res), maxResultLength,
+		)
+	}
+	return nil
+}
+
+// checkOrder returns an error if RejectNonCanonical is set and the node
+// prev was not expected before next. Attestations come before operations,
+// and both are strictly ordered.
+func (d *deserializationContext) checkOrder(prev, next *tsNode) error {
+	if !d.opts.RejectNonCanonical || prev == nil {
+		return nil
+	}
+	var c int
+	switch {
+	case prev.att != nil && next.att != nil:
+		c = compareAttestations(prev.att, next.att)
+	case prev.op != nil && next.op != nil:
+		c = compareOps(prev.op, next.op)
+	case prev.att != nil:
+		c = -1
+	default:
+		c = 1
+	}
+	if c >= 0 {
+		return fmt.Errorf("non-canonical order: %v before %v", prev, next)
+	}
+	return nil
+}
+
+// tsNode is either an attestation or an operation of a timestamp. It is
+// used to check the order of the decoded nodes.
+type tsNode struct {
+	att Attestation
+	op  opCode
+}
+
+func (n *tsNode) String() string {
+	if n.att != nil {
+		return fmt.Sprint(n.att)
+	}
+	return fmt.Sprint(n.op)
+}
+
+// encodedPayload returns the serialized attestation payload, or nil if it
+// cannot be encoded.
+func encodedPayload(att Attestation) []byte {
+	buf := &bytes.Buffer{}
+	if err := att.encode(newSerializationContext(buf)); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,174 @@
+package opentimestamps
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timestampBuilder writes raw timestamp bytes for the decoder tests
+type timestampBuilder struct {
+	buf bytes.Buffer
+}
+
+func (b *timestampBuilder) ctx() *serializationContext {
+	return newSerializationContext(&b.buf)
+}
+
+func (b *timestampBuilder) attestation(tag, payload []byte) {
+	b.ctx().writeByte(0x00)
+	b.ctx().writeBytes(tag)
+	b.ctx().writeVarBytes(payload)
+}
+
+func (b *timestampBuilder) bitcoinAttestation(payload []byte) {
+	b.attestation(BitcoinAttestationTag, payload)
+}
+
+func (b *timestampBuilder) height(h uint64) {
+	buf := &bytes.Buffer{}
+	newSerializationContext(buf).writeVarUint(h)
+	b.bitcoinAttestation(buf.Bytes())
+}
+
+func (b *timestampBuilder) next() {
+	b.ctx().writeByte(0xff)
+}
+
+func (b *timestampBuilder) bytes() []byte {
+	return b.buf.Bytes()
+}
+
+var testMessage = newTestDigest("message")
+
+func decodeWithOptions(in []byte, opts DecodeOptions) error {
+	_, err := DecodeTimestampWithOptions(
+		bytes.NewBuffer(in), testMessage, opts,
+	)
+	return err
+}
+
+func TestDecodeOptionsStrictEOF(t *testing.T) {
+	b := &timestampBuilder{}
+	b.height(1)
+	in := append(b.bytes(), 0x00)
+
+	assert.NoError(t, decodeWithOptions(in, DefaultDecodeOptions))
+	assert.Error(t, decodeWithOptions(in, DecodeOptions{StrictEOF: true}))
+	assert.NoError(t, decodeWithOptions(
+		b.bytes(), DecodeOptions{StrictEOF: true},
+	))
+}
+
+func TestDecodeOptionsNonCanonicalVarUint(t *testing.T) {
+	b := &timestampBuilder{}
+	b.bitcoinAttestation([]byte{0x81, 0x00})
+
+	opts := DecodeOptions{RejectNonCanonical: true}
+	assert.NoError(t, decodeWithOptions(b.bytes(), DefaultDecodeOptions))
+	assert.Error(t, decodeWithOptions(b.bytes(), opts))
+}
+
+func TestDecodeOptionsOrder(t *testing.T) {
+	opts := DecodeOptions{RejectNonCanonical: true}
+
+	sorted := &timestampBuilder{}
+	sorted.next()
+	sorted.height(0x7f)
+	sorted.height(0x80)
+	assert.NoError(t, decodeWithOptions(sorted.bytes(), opts))
+
+	unsorted := &timestampBuilder{}
+	unsorted.next()
+	unsorted.height(0x80)
+	unsorted.height(0x7f)
+	assert.NoError(t, decodeWithOptions(unsorted.bytes(), DefaultDecodeOptions))
+	assert.Error(t, decodeWithOptions(unsorted.bytes(), opts))
+
+	duplicate := &timestampBuilder{}
+	duplicate.next()
+	duplicate.height(1)
+	duplicate.height(1)
+	assert.Error(t, decodeWithOptions(duplicate.bytes(), opts))
+
+	opFirst := &timestampBuilder{}
+	opFirst.next()
+	opFirst.ctx().writeByte(opSHA256.tag)
+	opFirst.height(1)
+	opFirst.height(1)
+	assert.NoError(t, decodeWithOptions(opFirst.bytes(), DefaultDecodeOptions))
+	assert.Error(t, decodeWithOptions(opFirst.bytes(), opts))
+}
+
+func sha256Chain(n int) []byte {
+	b := &timestampBuilder{}
+	for i := 0; i < n; i++ {
+		b.ctx().writeByte(opSHA256.tag)
+	}
+	b.height(1)
+	return b.bytes()
+}
+
+func TestDecodeOptionsMaxDepth(t *testing.T) {
+	in := sha256Chain(10)
+	assert.Error(t, decodeWithOptions(in, DecodeOptions{MaxDepth: 10}))
+	assert.NoError(t, decodeWithOptions(in, DecodeOptions{MaxDepth: 11}))
+	assert.Error(t, decodeWithOptions(sha256Chain(1000), DefaultDecodeOptions))
+}
+
+func TestDecodeOptionsMaxNodesAndAttestations(t *testing.T) {
+	b := &timestampBuilder{}
+	b.next()
+	b.height(1)
+	b.next()
+	b.height(2)
+	b.ctx().writeByte(opSHA256.tag)
+	b.height(3)
+	in := b.bytes()
+
+	assert.Error(t, decodeWithOptions(in, DecodeOptions{MaxNodes: 1}))
+	assert.NoError(t, decodeWithOptions(in, DecodeOptions{MaxNodes: 2}))
+	assert.Error(t, decodeWithOptions(in, DecodeOptions{MaxAttestations: 2}))
+	assert.NoError(t, decodeWithOptions(in, DecodeOptions{MaxAttestations: 3}))
+}
+
+func TestDecodeOptionsMaxBytes(t *testing.T) {
+	in := sha256Chain(10)
+	n := int64(len(in))
+	assert.Error(t, decodeWithOptions(in, DecodeOptions{MaxBytes: n - 1}))
+	assert.NoError(t, decodeWithOptions(
+		in, DecodeOptions{MaxBytes: n, StrictEOF: true},
+	))
+}
+
+func TestDecodeOptionsResultLength(t *testing.T) {
+	// 32 << 8 is the first hexlify result over maxResultLength
+	b := &timestampBuilder{}
+	for i := 0; i < 8; i++ {
+		b.ctx().writeByte(opHexlify.tag)
+	}
+	b.height(1)
+
+	opts := DecodeOptions{EnforceResultLength: true}
+	assert.NoError(t, decodeWithOptions(b.bytes(), DefaultDecodeOptions))
+	assert.Error(t, decodeWithOptions(b.bytes(), opts))
+}
+
+func TestDecodeStrictExamples(t *testing.T) {
+	for _, path := range examplePaths() {
+		orgBytes, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		_, err = DecodeDetachedTimestampWithOptions(
+			bytes.NewBuffer(orgBytes), StrictDecodeOptions,
+		)
+		assert.NoError(t, err, path)
+
+		_, err = DecodeDetachedTimestampWithOptions(
+			bytes.NewBuffer(append(orgBytes, 0x00)), StrictDecodeOptions,
+		)
+		assert.Error(t, err, path)
+	}
+}
@@ -30,6 +30,12 @@ func (d *DetachedTimestamp) Dump() string {
 	return w.String()
 }
 
+// HashOpName returns the name of the operation used to hash the file, like
+// SHA256.
+func (d *DetachedTimestamp) HashOpName() string {
+	return d.HashOp.name
+}
+
 func (d *DetachedTimestamp) encode(ctx *serializationContext) error {
 	if err := ctx.writeBytes(fileHeaderMagic); err != nil {
 		return err
@@ -50,6 +56,42 @@ func (d *DetachedTimestamp) WriteToStream(w io.Writer) error {
 	return d.encode(&serializationContext{w})
 }
 
+// MarshalBinary returns the detached timestamp in the .ots file format.
+func (d *DetachedTimestamp) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := d.WriteToStream(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a detached timestamp in the .ots file format.
+func (d *DetachedTimestamp) UnmarshalBinary(data []byte) error {
+	_, err := d.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// WriteTo writes the detached timestamp in the .ots file format to w.
+func (d *DetachedTimestamp) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := d.WriteToStream(cw)
+	return cw.n, err
+}
+
+// ReadFrom decodes a detached timestamp in the .ots file format from r. The
+// timestamp must extend to the end of r.
+func (d *DetachedTimestamp) ReadFrom(r io.Reader) (int64, error) {
+	opts := DefaultDecodeOptions
+	opts.StrictEOF = true
+	cr := &countingReader{r: r}
+	dts, err := DecodeDetachedTimestampWithOptions(cr, opts)
+	if err != nil {
+		return cr.n, err
+	}
+	*d = *dts
+	return cr.n, nil
+}
+
 func NewDetachedTimestamp(
 	hashOp cryptOp, fileHash []byte, ts *Timestamp,
 ) (*DetachedTimestamp, error) {
@@ -63,7 +105,30 @@ func NewDetachedTimestamp(
 }
 
 func NewDetachedTimestampFromReader(r io.Reader) (*DetachedTimestamp, error) {
-	ctx := newDeserializationContext(r)
+	return DecodeDetachedTimestampWithOptions(r, DefaultDecodeOptions)
+}
+
+// DecodeDetachedTimestampWithOptions parses a detached timestamp from r,
+// applying the limits and checks of opts.
+func DecodeDetachedTimestampWithOptions(
+	r io.Reader, opts DecodeOptions,
+) (*DetachedTimestamp, error) {
+	ctx := newDeserializationContextWithOptions(r, opts)
+	dts, err := decodeDetachedTimestamp(ctx)
+	if err != nil {
+		return nil, ctx.decodeError(err)
+	}
+	if opts.StrictEOF && !ctx.assertEOF() {
+		return nil, ctx.decodeError(
+			fmt.Errorf("expected EOF after detached timestamp"),
+		)
+	}
+	return dts, nil
+}
+
+func decodeDetachedTimestamp(
+	ctx *deserializationContext,
+) (*DetachedTimestamp, error) {
 	if err := ctx.assertMagic([]byte(fileHeaderMagic)); err != nil {
 		return nil, err
 	}
@@ -94,5 +159,6 @@ func NewDetachedTimestampFromPath(p string) (*DetachedTimestamp, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 	return NewDetachedTimestampFromReader(f)
 }
@@ -0,0 +1,149 @@
+package opentimestamps
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// fuzzDecodeOptions keep the fuzzer from spending its time on huge inputs
+var fuzzDecodeOptions = DecodeOptions{
+	MaxDepth:        256,
+	MaxNodes:        10000,
+	MaxBytes:        1 << 16,
+	MaxAttestations: 1000,
+}
+
+func addExampleSeeds(f *testing.F) {
+	for _, path := range examplePaths() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
+
+// canonicalCopy returns a copy of ts with the attestations and operations of
+// all timestamps in canonical order, as they are encoded.
+func canonicalCopy(ts *Timestamp) *Timestamp {
+	c := ts.copy()
+	c.Walk(func(ts *Timestamp) {
+		sortAttestations(ts.Attestations)
+		sortOps(ts.ops)
+	})
+	return c
+}
+
+// checkRoundTrip encodes ts, decodes the result and checks that the decoded
+// timestamp is equal to ts in canonical order and encodes to the same bytes.
+func checkRoundTrip(t *testing.T, ts *Timestamp) {
+	encoded, err := ts.MarshalBinary()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	decoded := &Timestamp{Message: ts.Message}
+	if err := decoded.UnmarshalBinary(encoded); err != nil {
+		t.Fatalf("decode of encoded timestamp failed: %v", err)
+	}
+	if !canonicalCopy(ts).Equal(decoded) {
+		t.Fatalf("round trip mismatch:\n%s\n%s", ts.Dump(), decoded.Dump())
+	}
+	reencoded, err := decoded.MarshalBinary()
+	if err != nil {
+		t.Fatalf("re-encode failed: %v", err)
+	}
+	if !bytes.Equal(encoded, reencoded) {
+		t.Fatalf("re-encoding mismatch: %x != %x", encoded, reencoded)
+	}
+}
+
+func FuzzDecodeDetachedTimestamp(f *testing.F) {
+	addExampleSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dts, err := DecodeDetachedTimestampWithOptions(
+			bytes.NewReader(data), fuzzDecodeOptions,
+		)
+		if err != nil {
+			return
+		}
+		checkRoundTrip(t, dts.Timestamp)
+
+		encoded, err := dts.MarshalBinary()
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		dts1 := &DetachedTimestamp{}
+		if err := dts1.UnmarshalBinary(encoded); err != nil {
+			t.Fatalf("decode of encoded timestamp failed: %v", err)
+		}
+		if !canonicalCopy(dts.Timestamp).Equal(dts1.Timestamp) {
+			t.Fatalf("detached round trip mismatch")
+		}
+	})
+}
+
+func FuzzDecodeTimestamp(f *testing.F) {
+	for _, path := range examplePaths() {
+		dts, err := NewDetachedTimestampFromPath(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		data, err := dts.Timestamp.MarshalBinary()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data, dts.Timestamp.Message)
+	}
+	// an operation before the attestations, which are out of order
+	b := &timestampBuilder{}
+	b.next()
+	b.ctx().writeByte(opSHA256.tag)
+	b.height(1)
+	b.next()
+	b.height(0x80)
+	b.height(0x7f)
+	f.Add(b.bytes(), testMessage)
+	f.Fuzz(func(t *testing.T, data, message []byte) {
+		if len(message) > maxResultLength {
+			return
+		}
+		opts := fuzzDecodeOptions
+		opts.EnforceResultLength = true
+		ts, err := DecodeTimestampWithOptions(
+			bytes.NewReader(data), message, opts,
+		)
+		if err != nil {
+			return
+		}
+		ts.Walk(func(subTs *Timestamp) {
+			if len(subTs.Message) > maxResultLength {
+				t.Fatalf(
+					"message length %d over maxResultLength",
+					len(subTs.Message),
+				)
+			}
+		})
+		checkRoundTrip(t, ts)
+	})
+}
+
+func FuzzDecodeStrict(f *testing.F) {
+	addExampleSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dts, err := DecodeDetachedTimestampWithOptions(
+			bytes.NewReader(data), StrictDecodeOptions,
+		)
+		if err != nil {
+			return
+		}
+		// canonical input must be reproduced exactly
+		encoded, err := dts.MarshalBinary()
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		if !bytes.Equal(data, encoded) {
+			t.Fatalf("strict decode not canonical: %x != %x", data, encoded)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+// Package socks5test provides a SOCKS5 proxy for tests.
+package socks5test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// A Server is a minimal SOCKS5 proxy supporting CONNECT with optional
+// username/password authentication. It records the requested addresses.
+type Server struct {
+	listener net.Listener
+	username string
+	password string
+
+	mu      sync.Mutex
+	targets []string
+}
+
+// NewServer starts a proxy on a local port. If username is set, clients
+// must authenticate with it and password.
+func NewServer(username, password string) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener: listener,
+		username: username,
+		password: password,
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, nil
+}
+
+// Addr returns the address of the proxy.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops accepting connections.
+func (s *Server) Close() {
+	s.listener.Close()
+}
+
+// Targets returns the addresses clients connected to, in order.
+func (s *Server) Targets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.targets...)
+}
+
+// handshake negotiates the method and reads the requested address
+func (s *Server) handshake(conn net.Conn) (string, error) {
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return "", err
+	}
+	methods := make([]byte, buf[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	method := byte(0)
+	if s.username != "" {
+		method = 2
+	}
+	found := false
+	for _, m := range methods {
+		found = found || m == method
+	}
+	if buf[0] != 5 || !found {
+		conn.Write([]byte{5, 0xff})
+		return "", fmt.Errorf("no acceptable method")
+	}
+	conn.Write([]byte{5, method})
+	if method == 2 {
+		readString := func() string {
+			n := make([]byte, 1)
+			io.ReadFull(conn, n)
+			b := make([]byte, n[0])
+			io.ReadFull(conn, b)
+			return string(b)
+		}
+		io.ReadFull(conn, make([]byte, 1))
+		username, password := readString(), readString()
+		if username != s.username || password != s.password {
+			conn.Write([]byte{1, 1})
+			return "", fmt.Errorf("authentication failed")
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return "", err
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		n := make([]byte, 1)
+		io.ReadFull(conn, n)
+		b := make([]byte, n[0])
+		io.ReadFull(conn, b)
+		host = string(b)
+	default:
+		return "", fmt.Errorf("unsupported address type %d", req[3])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(
+		host, strconv.Itoa(int(binary.BigEndian.Uint16(port))),
+	), nil
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	addr, err := s.handshake(conn)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.targets = append(s.targets, addr)
+	s.mu.Unlock()
+	target, err := net.Dial("tcp", addr)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
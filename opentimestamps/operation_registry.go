@@ -0,0 +1,111 @@
+package opentimestamps
+
+import (
+	"fmt"
+	"sync"
+)
+
+// An OpSpec describes an operation that is registered with RegisterOp.
+// Exactly one of Unary and Binary must be set. Binary operations take a
+// varbytes argument. Unary operations with a DigestLength greater than zero
+// are hash operations and can be used as the file hash op of a
+// DetachedTimestamp.
+type OpSpec struct {
+	Tag          byte
+	Name         string
+	Unary        func(message []byte) ([]byte, error)
+	Binary       func(message, argument []byte) ([]byte, error)
+	DigestLength int
+}
+
+func (s OpSpec) newOp() (opCode, error) {
+	switch {
+	case s.Name == "":
+		return nil, fmt.Errorf("op %02x has no name", s.Tag)
+	case s.Tag == 0x00 || s.Tag == 0xff:
+		return nil, fmt.Errorf("op tag %02x is reserved", s.Tag)
+	case (s.Unary == nil) == (s.Binary == nil):
+		return nil, fmt.Errorf(
+			"op %s must have either a unary or a binary function", s.Name,
+		)
+	case s.Binary != nil && s.DigestLength != 0:
+		return nil, fmt.Errorf("binary op %s has a digest length", s.Name)
+	case s.DigestLength < 0 || s.DigestLength > maxResultLength:
+		return nil, fmt.Errorf(
+			"invalid digest length %d for op %s", s.DigestLength, s.Name,
+		)
+	case s.Binary != nil:
+		return newBinaryOp(s.Tag, s.Name, s.Binary), nil
+	case s.DigestLength > 0:
+		return newCryptOp(s.Tag, s.Name, s.Unary, s.DigestLength), nil
+	}
+	return newUnaryOp(s.Tag, s.Name, s.Unary), nil
+}
+
+var opRegistry = struct {
+	sync.RWMutex
+	byTag  map[byte]opCode
+	byName map[string]opCode
+}{
+	byTag:  map[byte]opCode{},
+	byName: map[string]opCode{},
+}
+
+func init() {
+	for _, op := range []opCode{
+		opAppend, opPrepend, opReverse, opHexlify, opSHA1, opRIPEMD160,
+		opSHA256, opKECCAK256,
+	} {
+		if err := registerOp(op); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func registerOp(op opCode) error {
+	name := opName(op)
+	opRegistry.Lock()
+	defer opRegistry.Unlock()
+	if prev, ok := opRegistry.byTag[op.opTag()]; ok {
+		return fmt.Errorf(
+			"op tag %02x already registered for %s", op.opTag(), opName(prev),
+		)
+	}
+	if _, ok := opRegistry.byName[name]; ok {
+		return fmt.Errorf("op name %s already registered", name)
+	}
+	opRegistry.byTag[op.opTag()] = op
+	opRegistry.byName[name] = op
+	return nil
+}
+
+// RegisterOp teaches the parser about a custom operation. It returns an
+// error if the spec is invalid or if its tag or name is already registered.
+// RegisterOp is safe for concurrent use.
+func RegisterOp(spec OpSpec) error {
+	op, err := spec.newOp()
+	if err != nil {
+		return err
+	}
+	return registerOp(op)
+}
+
+func lookupOp(tag byte) (opCode, bool) {
+	opRegistry.RLock()
+	defer opRegistry.RUnlock()
+	op, ok := opRegistry.byTag[tag]
+	return op, ok
+}
+
+// opName returns the name of an operation without its argument
+func opName(o opCode) string {
+	switch o := o.(type) {
+	case *binaryOp:
+		return o.name
+	case *unaryOp:
+		return o.name
+	case *cryptOp:
+		return o.name
+	}
+	return fmt.Sprint(o)
+}
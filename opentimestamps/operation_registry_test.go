@@ -0,0 +1,136 @@
+package opentimestamps
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	opSHA3256Tag = 0x0a
+	opShortTag   = 0x0b
+	opXORTag     = 0xe0
+)
+
+func msgSHA3256(msg []byte) ([]byte, error) {
+	res := sha3.Sum256(msg)
+	return res[:], nil
+}
+
+// msgShort returns a 16 byte digest, registered with a length of 32
+func msgShort(msg []byte) ([]byte, error) {
+	res := sha256.Sum256(msg)
+	return res[:16], nil
+}
+
+func msgXOR(msg, arg []byte) ([]byte, error) {
+	res := make([]byte, len(msg))
+	for i := range msg {
+		res[i] = msg[i] ^ arg[i%len(arg)]
+	}
+	return res, nil
+}
+
+func init() {
+	for _, spec := range []OpSpec{
+		{Tag: opSHA3256Tag, Name: "SHA3-256", Unary: msgSHA3256, DigestLength: 32},
+		{Tag: opShortTag, Name: "SHORT", Unary: msgShort, DigestLength: 32},
+		{Tag: opXORTag, Name: "XOR", Binary: msgXOR},
+	} {
+		if err := RegisterOp(spec); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func TestRegisteredOpRoundTrip(t *testing.T) {
+	b := &timestampBuilder{}
+	b.ctx().writeByte(opXORTag)
+	b.ctx().writeVarBytes([]byte{0x01})
+	b.ctx().writeByte(opSHA3256Tag)
+	b.height(1)
+	in := b.bytes()
+
+	ts, err := NewTimestampFromReader(bytes.NewBuffer(in), testMessage)
+	require.NoError(t, err)
+
+	xored, err := msgXOR(testMessage, []byte{0x01})
+	require.NoError(t, err)
+	expected, err := msgSHA3256(xored)
+	require.NoError(t, err)
+	var leaf *Timestamp
+	ts.Walk(func(ts *Timestamp) {
+		if len(ts.Attestations) > 0 {
+			leaf = ts
+		}
+	})
+	require.NotNil(t, leaf)
+	assert.Equal(t, expected, leaf.Message)
+
+	dump := ts.Dump()
+	assert.True(t, strings.Contains(dump, "XOR 01"), dump)
+	assert.True(t, strings.Contains(dump, "SHA3-256"), dump)
+
+	out, err := ts.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, in, out)
+}
+
+func TestRegisteredOpDigestLength(t *testing.T) {
+	b := &timestampBuilder{}
+	b.ctx().writeByte(opShortTag)
+	b.height(1)
+	_, err := NewTimestampFromReader(bytes.NewBuffer(b.bytes()), testMessage)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "16 byte digest")
+}
+
+func TestRegisteredOpFileHash(t *testing.T) {
+	op, ok := lookupOp(opSHA3256Tag)
+	require.True(t, ok)
+	fileHash, err := msgSHA3256([]byte("file"))
+	require.NoError(t, err)
+
+	b := &timestampBuilder{}
+	b.height(1)
+	ts, err := NewTimestampFromReader(bytes.NewBuffer(b.bytes()), fileHash)
+	require.NoError(t, err)
+	dts, err := NewDetachedTimestamp(*op.(*cryptOp), fileHash, ts)
+	require.NoError(t, err)
+
+	out, err := dts.MarshalBinary()
+	require.NoError(t, err)
+	decoded := &DetachedTimestamp{}
+	require.NoError(t, decoded.UnmarshalBinary(out))
+	assert.Equal(t, "SHA3-256", decoded.HashOp.name)
+	assert.True(t, strings.HasPrefix(decoded.Dump(), "File SHA3-256 hash"))
+}
+
+func TestRegisterOpConflicts(t *testing.T) {
+	unary := func(msg []byte) ([]byte, error) { return msg, nil }
+	for _, spec := range []OpSpec{
+		// tag collisions
+		{Tag: opSHA256.tag, Name: "OTHER", Unary: unary},
+		{Tag: opSHA3256Tag, Name: "OTHER", Unary: unary},
+		// name collision
+		{Tag: 0xe1, Name: "SHA256", Unary: unary},
+		// reserved tags
+		{Tag: 0x00, Name: "OTHER", Unary: unary},
+		{Tag: 0xff, Name: "OTHER", Unary: unary},
+		// invalid specs
+		{Tag: 0xe1, Unary: unary},
+		{Tag: 0xe1, Name: "OTHER"},
+		{Tag: 0xe1, Name: "OTHER", Unary: unary, Binary: msgXOR},
+		{Tag: 0xe1, Name: "OTHER", Binary: msgXOR, DigestLength: 32},
+		{Tag: 0xe1, Name: "OTHER", Unary: unary, DigestLength: -1},
+	} {
+		assert.Error(t, RegisterOp(spec), "%#v", spec)
+	}
+	_, ok := lookupOp(0xe1)
+	assert.False(t, ok)
+}
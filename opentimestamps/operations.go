@@ -1,12 +1,14 @@
 package opentimestamps
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 
 	"golang.org/x/crypto/ripemd160"
+	"golang.org/x/crypto/sha3"
 )
 
 const maxResultLength = 4096
@@ -66,8 +68,20 @@ func msgSHA256(msg []byte) ([]byte, error) {
 	return res[:], nil
 }
 
+// msgKECCAK256 returns the original Keccak-256 digest used by Ethereum, which
+// differs from the standardized SHA3-256.
+func msgKECCAK256(msg []byte) ([]byte, error) {
+	h := sha3.NewLegacyKeccak256()
+	_, err := h.Write(msg)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum([]byte{}), nil
+}
+
 type opCode interface {
 	match(byte) bool
+	opTag() byte
 	decode(*deserializationContext) (opCode, error)
 	encode(*serializationContext) error
 	apply(message []byte) ([]byte, error)
@@ -82,6 +96,10 @@ func (o op) match(tag byte) bool {
 	return o.tag == tag
 }
 
+func (o op) opTag() byte {
+	return o.tag
+}
+
 type unaryOp struct {
 	op
 	msgOp unaryMsgOp
@@ -132,6 +150,22 @@ func (c *cryptOp) decode(ctx *deserializationContext) (opCode, error) {
 	return &cryptOp{*u.(*unaryOp), c.digestLength}, nil
 }
 
+// apply returns an error if the digest doesn't have the digest length of
+// the op, which can happen with registered ops.
+func (c *cryptOp) apply(message []byte) ([]byte, error) {
+	res, err := c.unaryOp.apply(message)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != c.digestLength {
+		return nil, fmt.Errorf(
+			"op %v returned %d byte digest, expected %d",
+			c, len(res), c.digestLength,
+		)
+	}
+	return res, nil
+}
+
 // Binary operations
 // We decode an extra varbyte argument and use it in apply()
 
@@ -185,20 +219,39 @@ var (
 	opSHA1      = newCryptOp(0x02, "SHA1", msgSHA1, 20)
 	opRIPEMD160 = newCryptOp(0x03, "RIPEMD160", msgRIPEMD160, 20)
 	opSHA256    = newCryptOp(0x08, "SHA256", msgSHA256, 32)
+	opKECCAK256 = newCryptOp(0x67, "KECCAK256", msgKECCAK256, 32)
 )
 
-var opCodes []opCode = []opCode{
-	opAppend, opPrepend, opReverse, opHexlify, opSHA1, opRIPEMD160,
-	opSHA256,
+// compareOps orders operations by tag and then by argument.
+func compareOps(a, b opCode) int {
+	ta, tb := a.opTag(), b.opTag()
+	switch {
+	case ta < tb:
+		return -1
+	case ta > tb:
+		return 1
+	}
+	return bytes.Compare(opArgument(a), opArgument(b))
+}
+
+// opsEqual returns true if both operations have the same tag and argument.
+func opsEqual(a, b opCode) bool {
+	return compareOps(a, b) == 0
+}
+
+func opArgument(o opCode) []byte {
+	if b, ok := o.(*binaryOp); ok {
+		return b.argument
+	}
+	return nil
 }
 
 func parseOp(ctx *deserializationContext, tag byte) (opCode, error) {
-	for _, op := range opCodes {
-		if op.match(tag) {
-			return op.decode(ctx)
-		}
+	op, ok := lookupOp(tag)
+	if !ok {
+		return nil, fmt.Errorf("could not decode tag %02x", tag)
 	}
-	return nil, fmt.Errorf("could not decode tag %02x", tag)
+	return op.decode(ctx)
 }
 
 func parseCryptOp(ctx *deserializationContext) (*cryptOp, error) {
@@ -76,3 +76,40 @@ func TestRIPEMD160(t *testing.T) {
 		hex.EncodeToString(out),
 	)
 }
+
+func TestMsgKECCAK256(t *testing.T) {
+	// empty input, as in the python-opentimestamps op tests
+	out, err := msgKECCAK256([]byte{})
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"c5d2460186f7233c927e7db2dcc703c0"+
+			"e500b653ca82273b7bfad8045d85a470",
+		hex.EncodeToString(out),
+	)
+
+	// RLP empty string, the root hash of an empty ethereum trie
+	out, err = msgKECCAK256([]byte{0x80})
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"56e81f171bcc55a6ff8345e692c0f86e"+
+			"5b48e01b996cadc001622fb5e363b421",
+		hex.EncodeToString(out),
+	)
+
+	// RLP empty list, the ethereum empty uncle hash
+	out, err = msgKECCAK256([]byte{0xc0})
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"1dcc4de8dec75d7aab85b567b6ccd41a"+
+			"d312451b948a7413f0a142fd40d49347",
+		hex.EncodeToString(out),
+	)
+}
+
+func TestParseKECCAK256(t *testing.T) {
+	ctx := newDeserializationContextFromBytes([]byte{0x67})
+	op, err := parseCryptOp(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "KECCAK256", op.String())
+	assert.Equal(t, 32, op.digestLength)
+}
@@ -4,25 +4,65 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/http/httputil"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 )
 
 const userAgent = "go-opentimestamps"
 
+// calendarContentType is the media type of timestamps sent by calendars.
+const calendarContentType = "application/vnd.opentimestamps.v1"
+
+// maxCalendarResponseSize is the largest response read from a calendar,
+// like in the reference implementation.
+const maxCalendarResponseSize = 10000
+
 const dumpResponse = false
 
 type RemoteCalendar struct {
 	baseURL string
 	client  *http.Client
-	log     *logrus.Logger
+	log     Logger
+	hooks   CalendarHooks
+}
+
+// A CalendarOption configures a RemoteCalendar.
+type CalendarOption func(c *RemoteCalendar)
+
+// WithLogger sets the logger of the calendar. By default, each calendar
+// logs to its own logrus.Logger.
+func WithLogger(l Logger) CalendarOption {
+	return func(c *RemoteCalendar) {
+		c.log = l
+	}
+}
+
+// WithHooks sets the hooks notified of the calendar requests. By default,
+// the requests are counted in expvar.
+func WithHooks(h CalendarHooks) CalendarOption {
+	return func(c *RemoteCalendar) {
+		c.hooks = h
+	}
+}
+
+// WithHTTPClient sets the client used for requests instead of
+// http.DefaultClient.
+func WithHTTPClient(client *http.Client) CalendarOption {
+	return func(c *RemoteCalendar) {
+		c.client = client
+	}
 }
 
-func NewRemoteCalendar(baseURL string) (*RemoteCalendar, error) {
+func NewRemoteCalendar(
+	baseURL string, opts ...CalendarOption,
+) (*RemoteCalendar, error) {
 	// FIXME remove this
 	if baseURL == "localhost" {
 		baseURL = "http://localhost:14788"
@@ -31,11 +71,16 @@ func NewRemoteCalendar(baseURL string) (*RemoteCalendar, error) {
 	if !strings.HasSuffix(baseURL, "/") {
 		baseURL += "/"
 	}
-	return &RemoteCalendar{
+	c := &RemoteCalendar{
 		baseURL,
 		http.DefaultClient,
 		logrus.New(),
-	}, nil
+		defaultCalendarHooks(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
 }
 
 // Check response status, return informational error message if
@@ -49,7 +94,9 @@ func checkStatusOK(resp *http.Response) error {
 		return fmt.Errorf("%s (body=nil)", errMsg)
 	}
 	defer resp.Body.Close()
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	bodyBytes, err := ioutil.ReadAll(
+		io.LimitReader(resp.Body, maxCalendarResponseSize),
+	)
 	if err != nil {
 		return fmt.Errorf("%s (bodyErr=%v)", errMsg, err)
 	} else {
@@ -58,7 +105,7 @@ func checkStatusOK(resp *http.Response) error {
 }
 
 func (c *RemoteCalendar) do(r *http.Request) (*http.Response, error) {
-	r.Header.Add("Accept", "application/vnd.opentimestamps.v1")
+	r.Header.Add("Accept", calendarContentType)
 	r.Header.Add("User-Agent", userAgent)
 	c.log.Debugf("> %s %s", r.Method, r.URL)
 	resp, err := c.client.Do(r)
@@ -80,9 +127,24 @@ func (c *RemoteCalendar) url(path string) string {
 	return c.baseURL + path
 }
 
-func (c *RemoteCalendar) Submit(digest []byte) (*Timestamp, error) {
-	body := bytes.NewBuffer(digest)
-	req, err := http.NewRequest("POST", c.url("digest"), body)
+// request sends a request to the calendar and decodes the returned
+// timestamp for message. The outcome is reported to the hooks.
+func (c *RemoteCalendar) request(
+	method, path string, body io.Reader, message []byte,
+) (ts *Timestamp, err error) {
+	start := time.Now()
+	status := 0
+	defer func() {
+		c.hooks.RequestDone(&CalendarRequest{
+			Calendar:   c.baseURL,
+			Method:     method,
+			Path:       path,
+			StatusCode: status,
+			Latency:    time.Since(start),
+			Err:        err,
+		})
+	}()
+	req, err := http.NewRequest(method, c.url(path), body)
 	if err != nil {
 		return nil, err
 	}
@@ -90,32 +152,87 @@ func (c *RemoteCalendar) Submit(digest []byte) (*Timestamp, error) {
 	if err != nil {
 		return nil, err
 	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	status = resp.StatusCode
+	if err := checkStatusOK(resp); err != nil {
+		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("expected 200, got %v", resp.Status)
+	if resp.Body == nil {
+		return nil, fmt.Errorf("calendar %s: empty response", c.baseURL)
 	}
-	return NewTimestampFromReader(resp.Body, digest)
-}
-
-func (c *RemoteCalendar) GetTimestamp(commitment []byte) (*Timestamp, error) {
-	url := c.url("timestamp/" + hex.EncodeToString(commitment))
-	req, err := http.NewRequest("GET", url, nil)
+	defer resp.Body.Close()
+	if err := checkContentType(resp); err != nil {
+		return nil, fmt.Errorf("calendar %s: %v", c.baseURL, err)
+	}
+	data, err := ioutil.ReadAll(
+		io.LimitReader(resp.Body, maxCalendarResponseSize+1),
+	)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.do(req)
+	if len(data) > maxCalendarResponseSize {
+		return nil, fmt.Errorf(
+			"calendar %s: response larger than %d bytes",
+			c.baseURL, maxCalendarResponseSize,
+		)
+	}
+	ts, err = decodeCalendarResponse(data, message)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("calendar %s: %v", c.baseURL, err)
 	}
-	if err := checkStatusOK(resp); err != nil {
-		return nil, err
+	return ts, nil
+}
+
+// checkContentType returns an error if the response isn't a timestamp. The
+// reference calendar server sends timestamps as application/octet-stream.
+func checkContentType(resp *http.Response) error {
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != calendarContentType &&
+		mediaType != "application/octet-stream") {
+		return fmt.Errorf("unexpected content type %q", contentType)
+	}
+	return nil
+}
+
+// calendarDecodeOptions limit the timestamps accepted from calendars. The
+// order of attestations and operations isn't checked, so calendars with
+// non-canonical encoders still work.
+var calendarDecodeOptions = DecodeOptions{
+	MaxDepth:            StrictDecodeOptions.MaxDepth,
+	MaxNodes:            StrictDecodeOptions.MaxNodes,
+	MaxBytes:            maxCalendarResponseSize,
+	MaxAttestations:     StrictDecodeOptions.MaxAttestations,
+	StrictEOF:           true,
+	EnforceResultLength: true,
+}
+
+// decodeCalendarResponse decodes the timestamp for message returned by a
+// calendar. The timestamp must use all of data and contain at least one
+// attestation.
+func decodeCalendarResponse(data []byte, message []byte) (*Timestamp, error) {
+	ts, err := DecodeTimestampWithOptions(
+		bytes.NewReader(data), message, calendarDecodeOptions,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %v", err)
 	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	attestations := 0
+	ts.Walk(func(ts *Timestamp) {
+		attestations += len(ts.Attestations)
+	})
+	if attestations == 0 {
+		return nil, fmt.Errorf("timestamp has no attestations")
 	}
-	return NewTimestampFromReader(resp.Body, commitment)
+	return ts, nil
+}
+
+func (c *RemoteCalendar) Submit(digest []byte) (*Timestamp, error) {
+	return c.request("POST", "digest", bytes.NewBuffer(digest), digest)
+}
+
+func (c *RemoteCalendar) GetTimestamp(commitment []byte) (*Timestamp, error) {
+	path := "timestamp/" + hex.EncodeToString(commitment)
+	return c.request("GET", path, nil, commitment)
 }
 
 type PendingTimestamp struct {
@@ -123,8 +240,8 @@ type PendingTimestamp struct {
 	PendingAttestation *pendingAttestation
 }
 
-func (p PendingTimestamp) Upgrade() (*Timestamp, error) {
-	cal, err := NewRemoteCalendar(p.PendingAttestation.uri)
+func (p PendingTimestamp) Upgrade(opts ...CalendarOption) (*Timestamp, error) {
+	cal, err := NewRemoteCalendar(p.PendingAttestation.uri, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -3,6 +3,9 @@ package opentimestamps
 import (
 	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
@@ -16,12 +19,12 @@ const calendarServerEnvvar = "GOTS_TEST_CALENDAR_SERVER"
 const bitcoinRegtestEnvvar = "GOTS_TEST_BITCOIN_REGTEST_SERVER"
 
 func newTestCalendar(url string) *RemoteCalendar {
-	logrus.SetLevel(logrus.DebugLevel)
-	cal, err := NewRemoteCalendar(url)
+	logger := logrus.New()
+	logger.Level = logrus.DebugLevel
+	cal, err := NewRemoteCalendar(url, WithLogger(logger))
 	if err != nil {
 		panic("could not create test calendar")
 	}
-	cal.log.Level = logrus.DebugLevel
 	return cal
 }
 
@@ -67,3 +70,83 @@ func TestRemoteCalendarRoundTrip(t *testing.T) {
 		_ = ts
 	}
 }
+
+// newCalendarResponse returns the encoding of a timestamp for message as a
+// calendar would return it
+func newCalendarResponse(t *testing.T, message []byte) []byte {
+	ts := &Timestamp{Message: message}
+	leaf := addOp(addOp(ts, newAppendOp([]byte("calendar"))), opSHA256)
+	leaf.Attestations = append(leaf.Attestations, newPendingAttestationURI(
+		"https://calendar.example.org",
+	))
+	data, err := encodeTimestamp(ts)
+	require.NoError(t, err)
+	return data
+}
+
+func TestRemoteCalendarResponses(t *testing.T) {
+	digest := newTestDigest("response")
+	valid := newCalendarResponse(t, digest)
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        []byte
+		err         string
+	}{
+		{"valid", calendarContentType, valid, ""},
+		{"parameters", calendarContentType + "; charset=binary", valid, ""},
+		{"octet stream", "application/octet-stream", valid, ""},
+		{"content type", "text/html", valid, "unexpected content type"},
+		{"no content type", "", valid, "unexpected content type"},
+		{"empty", calendarContentType, nil, "invalid timestamp"},
+		{
+			"trailing data", calendarContentType,
+			append(append([]byte{}, valid...), 0x00), "expected EOF",
+		},
+		{
+			"too large", calendarContentType,
+			make([]byte, maxCalendarResponseSize+1), "larger than 10000 bytes",
+		},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				body, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, digest, body)
+				w.Header()["Content-Type"] = []string{tc.contentType}
+				w.Write(tc.body)
+			},
+		))
+		cal, err := NewRemoteCalendar(server.URL)
+		require.NoError(t, err)
+		ts, err := cal.Submit(digest)
+		server.Close()
+		if tc.err == "" {
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, digest, ts.Message)
+			continue
+		}
+		require.Error(t, err, tc.name)
+		assert.Contains(t, err.Error(), tc.err, tc.name)
+		assert.Contains(t, err.Error(), server.URL, tc.name)
+	}
+}
+
+func TestDecodeCalendarResponse(t *testing.T) {
+	digest := newTestDigest("response")
+	ts, err := decodeCalendarResponse(newCalendarResponse(t, digest), digest)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(PendingTimestamps(ts)))
+
+	_, err = decodeCalendarResponse([]byte{0x08}, digest)
+	assert.Error(t, err)
+
+	// the limits of strict decoding apply
+	deep := newMerkleTimestamp(1, 200)
+	data, err := encodeTimestamp(deep)
+	require.NoError(t, err)
+	require.True(t, len(data) < maxCalendarResponseSize)
+	_, err = decodeCalendarResponse(data, deep.Message)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "recursion limit")
+}
@@ -72,52 +72,136 @@ func (s serializationContext) writeVarBytes(arr []byte) error {
 	return s.writeBytes(arr)
 }
 
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
 // deserializationContext helps decoding values from the ots format
 type deserializationContext struct {
-	r io.Reader
+	r     io.Reader
+	br    io.ByteReader
+	opts  DecodeOptions
+	state decodeState
+	// pos is the number of bytes consumed from r
+	pos int64
+}
+
+// A DecodeError is returned when a timestamp cannot be decoded. Offset is the
+// number of bytes consumed from the input when the error occurred.
+type DecodeError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode error at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeError wraps err in a DecodeError with the current position
+func (d *deserializationContext) decodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &DecodeError{d.pos, err}
 }
 
 // safety boundary for readBytes
 // allocation limit for arrays
 const maxReadSize = (1 << 12)
 
-func (d deserializationContext) dump() string {
-	arr, _ := d.r.(*bufio.Reader).Peek(512)
+func (d *deserializationContext) dump() string {
+	br, ok := d.r.(*bufio.Reader)
+	if !ok {
+		return ""
+	}
+	arr, _ := br.Peek(512)
 	return fmt.Sprintf("% x", arr)
 }
 
-// readBytes reads n bytes.
-func (d deserializationContext) readBytes(n int) ([]byte, error) {
+// checkLimit returns an error if reading n more bytes exceeds the byte limit
+func (d *deserializationContext) checkLimit(n int) error {
+	if max := d.opts.MaxBytes; max > 0 && d.pos+int64(n) > max {
+		return fmt.Errorf("over byte limit: %d", max)
+	}
+	return nil
+}
+
+// readBytes reads n bytes. If the input ends before n bytes are read,
+// io.ErrUnexpectedEOF is returned.
+func (d *deserializationContext) readBytes(n int) ([]byte, error) {
 	if n > maxReadSize {
 		return nil, fmt.Errorf("over maxReadSize: %d", maxReadSize)
 	}
+	if err := d.checkLimit(n); err != nil {
+		return nil, err
+	}
 	b := make([]byte, n)
-	m, err := d.r.Read(b)
-	if err != nil {
-		return b, err
+	m, err := io.ReadFull(d.r, b)
+	d.pos += int64(m)
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
 	}
-	if n != m {
-		return b, fmt.Errorf("expected %d bytes, got %d", n, m)
+	if err != nil {
+		return nil, err
 	}
-	return b[:], nil
+	return b, nil
 }
 
-// readByte reads a single byte.
-func (d deserializationContext) readByte() (byte, error) {
-	arr, err := d.readBytes(1)
+// readByte reads a single byte. If the input is at its end,
+// io.ErrUnexpectedEOF is returned.
+func (d *deserializationContext) readByte() (byte, error) {
+	if d.br == nil {
+		arr, err := d.readBytes(1)
+		if err != nil {
+			return 0, err
+		}
+		return arr[0], nil
+	}
+	if err := d.checkLimit(1); err != nil {
+		return 0, err
+	}
+	b, err := d.br.ReadByte()
+	if err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	}
 	if err != nil {
 		return 0, err
 	}
-	return arr[0], nil
+	d.pos += 1
+	return b, nil
 }
 
 // readBool reads a boolean.
-func (d deserializationContext) readBool() (bool, error) {
-	arr, err := d.readBytes(1)
+func (d *deserializationContext) readBool() (bool, error) {
+	v, err := d.readByte()
 	if err != nil {
 		return false, err
 	}
-	switch v := arr[0]; v {
+	switch v {
 	case 0x00:
 		return false, nil
 	case 0xff:
@@ -128,7 +212,7 @@ func (d deserializationContext) readBool() (bool, error) {
 }
 
 // readVarUint reads a variable-length uint64.
-func (d deserializationContext) readVarUint() (uint64, error) {
+func (d *deserializationContext) readVarUint() (uint64, error) {
 	// NOTE
 	// the original python implementation has no uint64 limit, but I
 	// don't think we'll ever need more that that.
@@ -146,6 +230,9 @@ func (d deserializationContext) readVarUint() (uint64, error) {
 		}
 		val |= shifted
 		if b&0x80 == 0 {
+			if b == 0 && shift > 0 && d.opts.RejectNonCanonical {
+				return 0, fmt.Errorf("non-canonical varuint")
+			}
 			return val, nil
 		}
 		shift += 7
@@ -153,7 +240,7 @@ func (d deserializationContext) readVarUint() (uint64, error) {
 }
 
 // readVarBytes reads variable-length number of bytes.
-func (d deserializationContext) readVarBytes(minLen, maxLen int) ([]byte, error) {
+func (d *deserializationContext) readVarBytes(minLen, maxLen int) ([]byte, error) {
 	v, err := d.readVarUint()
 	if err != nil {
 		return nil, err
@@ -174,7 +261,7 @@ func (d deserializationContext) readVarBytes(minLen, maxLen int) ([]byte, error)
 
 // assertMagic removes reads the expected bytes from the stream. Returns an
 // error if the bytes are unexpected.
-func (d deserializationContext) assertMagic(expected []byte) error {
+func (d *deserializationContext) assertMagic(expected []byte) error {
 	arr, err := d.readBytes(len(expected))
 	if err != nil {
 		return err
@@ -190,17 +277,39 @@ func (d deserializationContext) assertMagic(expected []byte) error {
 
 // assertEOF reads a byte and returns true if the end of the reader is reached.
 // Careful: the read operation is a side-effect.
-func (d deserializationContext) assertEOF() bool {
+func (d *deserializationContext) assertEOF() bool {
 	// Unfortunately we can't always do a zero-byte read here, since some
 	// reader implementations fail to return EOF. This means assertEOF
-	_, err := d.readByte()
+	// consumes a byte if the reader is not at its end.
+	//
+	// The byte limit does not apply here, so we read from d.r directly.
+	if d.br != nil {
+		_, err := d.br.ReadByte()
+		return err == io.EOF
+	}
+	_, err := io.ReadFull(d.r, make([]byte, 1))
 	return err == io.EOF
 }
 
 // newDeserializationContext returns a deserializationContext for a reader
 func newDeserializationContext(r io.Reader) *deserializationContext {
-	// TODO
-	// bufio is used here to allow debugging via d.dump()
-	// once this code here is robust enough we can just pass r
-	return &deserializationContext{bufio.NewReader(r)}
+	return newDeserializationContextWithOptions(r, DefaultDecodeOptions)
+}
+
+// newDeserializationContextWithOptions returns a deserializationContext for
+// a reader that applies the given DecodeOptions. Readers that don't
+// implement io.ByteReader are wrapped in a bufio.Reader unless
+// opts.Unbuffered is set.
+func newDeserializationContextWithOptions(
+	r io.Reader, opts DecodeOptions,
+) *deserializationContext {
+	if _, ok := r.(io.ByteReader); !ok && !opts.Unbuffered {
+		r = bufio.NewReader(r)
+	}
+	br, _ := r.(io.ByteReader)
+	return &deserializationContext{
+		r:    r,
+		br:   br,
+		opts: opts,
+	}
 }
@@ -2,10 +2,14 @@ package opentimestamps
 
 import (
 	"bytes"
+	"io"
+	"io/ioutil"
 	"math"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func newDeserializationContextFromBytes(in []byte) *deserializationContext {
@@ -151,3 +155,125 @@ func TestReadWrite(t *testing.T) {
 		assert.True(t, d.assertEOF())
 	}
 }
+
+func TestReadShortReads(t *testing.T) {
+	data := []byte{
+		0x00, 0x01, 0x02, // bytes
+		0xff,       // bool true
+		0x80, 0x02, // varuint 0x100
+	}
+	readAll := func(d *deserializationContext) {
+		v, err := d.readBytes(3)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x00, 0x01, 0x02}, v)
+		b, err := d.readBool()
+		assert.NoError(t, err)
+		assert.True(t, b)
+		n, err := d.readVarUint()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0x100), n)
+		assert.Equal(t, int64(len(data)), d.pos)
+		assert.True(t, d.assertEOF())
+	}
+
+	for _, opts := range []DecodeOptions{
+		DefaultDecodeOptions, {Unbuffered: true},
+	} {
+		readAll(newDeserializationContextWithOptions(
+			iotest.OneByteReader(bytes.NewReader(data)), opts,
+		))
+		readAll(newDeserializationContextWithOptions(
+			iotest.DataErrReader(bytes.NewReader(data)), opts,
+		))
+		readAll(newDeserializationContextWithOptions(
+			iotest.HalfReader(bytes.NewReader(data)), opts,
+		))
+	}
+}
+
+func TestReadUnexpectedEOF(t *testing.T) {
+	for _, opts := range []DecodeOptions{
+		DefaultDecodeOptions, {Unbuffered: true},
+	} {
+		d := newDeserializationContextWithOptions(
+			iotest.OneByteReader(bytes.NewReader([]byte{0x01, 0x02})),
+			opts,
+		)
+		_, err := d.readBytes(3)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.Equal(t, int64(2), d.pos)
+
+		_, err = d.readByte()
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+		d = newDeserializationContextWithOptions(
+			iotest.DataErrReader(bytes.NewReader([]byte{0x80})), opts,
+		)
+		_, err = d.readVarUint()
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestReadError(t *testing.T) {
+	d := newDeserializationContext(iotest.TimeoutReader(
+		iotest.OneByteReader(bytes.NewReader([]byte{0x01, 0x02})),
+	))
+	_, err := d.readBytes(2)
+	assert.Equal(t, iotest.ErrTimeout, err)
+}
+
+func TestUnbufferedDoesNotReadAhead(t *testing.T) {
+	b := &timestampBuilder{}
+	b.height(1)
+	in := append(b.bytes(), []byte("trailing")...)
+
+	r := iotest.OneByteReader(bytes.NewReader(in))
+	_, err := DecodeTimestampWithOptions(
+		r, testMessage, DecodeOptions{Unbuffered: true},
+	)
+	require.NoError(t, err)
+	rest, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("trailing"), rest)
+}
+
+func TestDecodeFromPipe(t *testing.T) {
+	for _, path := range examplePaths() {
+		orgBytes, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+
+		pr, pw := io.Pipe()
+		go func() {
+			// write in odd-sized chunks to produce short reads
+			for i := 0; i < len(orgBytes); i += 7 {
+				end := i + 7
+				if end > len(orgBytes) {
+					end = len(orgBytes)
+				}
+				pw.Write(orgBytes[i:end])
+			}
+			pw.Close()
+		}()
+
+		opts := DefaultDecodeOptions
+		opts.StrictEOF = true
+		_, err = DecodeDetachedTimestampWithOptions(pr, opts)
+		assert.NoError(t, err, path)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	orgBytes, err := ioutil.ReadFile("../examples/hello-world.txt.ots")
+	require.NoError(t, err)
+
+	for _, n := range []int{0, 1, 40, len(orgBytes) - 1} {
+		_, err := NewDetachedTimestampFromReader(
+			bytes.NewReader(orgBytes[:n]),
+		)
+		require.Error(t, err)
+		decodeErr, ok := err.(*DecodeError)
+		require.True(t, ok, "%T", err)
+		assert.Equal(t, io.ErrUnexpectedEOF, decodeErr.Err)
+		assert.Equal(t, int64(n), decodeErr.Offset)
+	}
+}
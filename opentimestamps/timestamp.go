@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 )
 
@@ -34,73 +35,278 @@ type Timestamp struct {
 
 // Walk calls the passed function f for this timestamp and all
 // downstream timestamps that are chained via operations.
+//
+// The timestamps are visited depth-first, in the same order as they are
+// encoded.
 func (t *Timestamp) Walk(f func(t *Timestamp)) {
-	f(t)
-	for _, l := range t.ops {
-		l.timestamp.Walk(f)
+	stack := []*Timestamp{t}
+	for len(stack) > 0 {
+		ts := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		f(ts)
+		for i := len(ts.ops) - 1; i >= 0; i-- {
+			stack = append(stack, ts.ops[i].timestamp)
+		}
 	}
 }
 
-func (t *Timestamp) encode(ctx *serializationContext) error {
-	n := len(t.Attestations) + len(t.ops)
-	if n == 0 {
-		return fmt.Errorf("cannot encode empty timestamp")
+// WalkPath is like Walk, but also passes the chain of timestamps leading
+// from t to the visited timestamp, starting with t. The path slice is only
+// valid during the call to f.
+func (t *Timestamp) WalkPath(f func(t *Timestamp, path []*Timestamp)) {
+	type walkFrame struct {
+		ts    *Timestamp
+		depth int
 	}
-	prefixAtt := []byte{0x00}
-	prefixOp := []byte{}
-	nextNode := func(prefix []byte) error {
-		n -= 1
-		if n > 0 {
-			return ctx.writeByte(0xff)
+	var path []*Timestamp
+	stack := []walkFrame{{t, 0}}
+	for len(stack) > 0 {
+		frame := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		path = path[:frame.depth]
+		f(frame.ts, path)
+		path = append(path, frame.ts)
+		for i := len(frame.ts.ops) - 1; i >= 0; i-- {
+			stack = append(stack, walkFrame{
+				frame.ts.ops[i].timestamp, frame.depth + 1,
+			})
 		}
-		if len(prefix) > 0 {
-			return ctx.writeBytes(prefix)
+	}
+}
+
+// Equal returns true if both timestamps have the same message, attestations
+// and operations, in the same order, and all downstream timestamps are equal
+// as well.
+func (t *Timestamp) Equal(other *Timestamp) bool {
+	type pair struct{ a, b *Timestamp }
+	stack := []pair{{t, other}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		a, b := p.a, p.b
+		if a == nil || b == nil {
+			if a != b {
+				return false
+			}
+			continue
+		}
+		if !bytes.Equal(a.Message, b.Message) ||
+			len(a.Attestations) != len(b.Attestations) ||
+			len(a.ops) != len(b.ops) {
+			return false
+		}
+		for i := range a.Attestations {
+			if !attestationsEqual(a.Attestations[i], b.Attestations[i]) {
+				return false
+			}
+		}
+		for i := range a.ops {
+			if !opsEqual(a.ops[i].opCode, b.ops[i].opCode) {
+				return false
+			}
+			stack = append(stack, pair{a.ops[i].timestamp, b.ops[i].timestamp})
 		}
-		return nil
 	}
-	// FIXME attestations should be sorted
-	for _, att := range t.Attestations {
-		if err := nextNode(prefixAtt); err != nil {
-			return err
+	return true
+}
+
+// Merge adds the attestations and operations of other, which must have the
+// same message, to t. Operations that t already has are merged recursively,
+// new ones are linked to the timestamps of other, which must not be modified
+// afterwards.
+func (t *Timestamp) Merge(other *Timestamp) error {
+	if !bytes.Equal(t.Message, other.Message) {
+		return fmt.Errorf(
+			"can't merge timestamps of different messages %x and %x",
+			t.Message, other.Message,
+		)
+	}
+	type pair struct{ dst, src *Timestamp }
+	stack := []pair{{t, other}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		dst, src := p.dst, p.src
+	attestations:
+		for _, att := range src.Attestations {
+			for _, existing := range dst.Attestations {
+				if attestationsEqual(att, existing) {
+					continue attestations
+				}
+			}
+			dst.Attestations = append(dst.Attestations, att)
 		}
-		if err := encodeAttestation(ctx, att); err != nil {
-			return err
+	ops:
+		for _, link := range src.ops {
+			for _, existing := range dst.ops {
+				if opsEqual(link.opCode, existing.opCode) {
+					stack = append(stack, pair{existing.timestamp, link.timestamp})
+					continue ops
+				}
+			}
+			dst.ops = append(dst.ops, link)
 		}
 	}
-	// FIXME ops should be sorted
-	for _, op := range t.ops {
-		if err := nextNode(prefixOp); err != nil {
-			return err
+	return nil
+}
+
+// encodeFrame is a timestamp on the explicit encoder stack, next being the
+// index of the next attestation or operation to write.
+type encodeFrame struct {
+	attestations []Attestation
+	ops          []tsLink
+	next         int
+}
+
+// sortAttestations sorts attestations in canonical order.
+func sortAttestations(attestations []Attestation) {
+	sort.SliceStable(attestations, func(i, j int) bool {
+		return compareAttestations(attestations[i], attestations[j]) < 0
+	})
+}
+
+// sortOps sorts operations in canonical order.
+func sortOps(ops []tsLink) {
+	sort.SliceStable(ops, func(i, j int) bool {
+		return compareOps(ops[i].opCode, ops[j].opCode) < 0
+	})
+}
+
+// newEncodeFrame returns the frame of ts with its attestations and
+// operations in canonical order, like the reference implementation writes
+// them.
+func newEncodeFrame(ts *Timestamp) encodeFrame {
+	f := encodeFrame{
+		attestations: append([]Attestation(nil), ts.Attestations...),
+		ops:          append([]tsLink(nil), ts.ops...),
+	}
+	sortAttestations(f.attestations)
+	sortOps(f.ops)
+	return f
+}
+
+func (t *Timestamp) encode(ctx *serializationContext) error {
+	if len(t.Attestations)+len(t.ops) == 0 {
+		return fmt.Errorf("cannot encode empty timestamp")
+	}
+	stack := []encodeFrame{newEncodeFrame(t)}
+	for len(stack) > 0 {
+		f := &stack[len(stack)-1]
+		n := len(f.attestations) + len(f.ops)
+		if f.next == n {
+			stack = stack[:len(stack)-1]
+			continue
 		}
-		if err := op.opCode.encode(ctx); err != nil {
-			return err
+		i := f.next
+		f.next += 1
+		if i < n-1 {
+			if err := ctx.writeByte(0xff); err != nil {
+				return err
+			}
+		}
+		if i < len(f.attestations) {
+			if err := ctx.writeByte(0x00); err != nil {
+				return err
+			}
+			err := encodeAttestation(ctx, f.attestations[i])
+			if err != nil {
+				return err
+			}
+			continue
 		}
-		if err := op.timestamp.encode(ctx); err != nil {
+		l := f.ops[i-len(f.attestations)]
+		if err := l.opCode.encode(ctx); err != nil {
 			return err
 		}
+		if len(l.timestamp.Attestations)+len(l.timestamp.ops) == 0 {
+			return fmt.Errorf("cannot encode empty timestamp")
+		}
+		stack = append(stack, newEncodeFrame(l.timestamp))
 	}
 	return nil
 }
 
-func (t *Timestamp) DumpIndent(w io.Writer, indent int, cfg dumpConfig) {
+// MarshalBinary returns the encoded timestamp. The message is not part of
+// the encoding.
+func (t *Timestamp) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if _, err := t.WriteTo(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a timestamp for t.Message, which must be set
+// beforehand.
+func (t *Timestamp) UnmarshalBinary(data []byte) error {
+	_, err := t.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// WriteTo writes the encoded timestamp to w. The message is not part of the
+// encoding.
+func (t *Timestamp) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := t.encode(newSerializationContext(cw))
+	return cw.n, err
+}
+
+// ReadFrom decodes a timestamp for t.Message, which must be set beforehand.
+// The timestamp must extend to the end of r.
+func (t *Timestamp) ReadFrom(r io.Reader) (int64, error) {
+	if t.Message == nil {
+		return 0, fmt.Errorf("cannot decode timestamp without message")
+	}
+	opts := DefaultDecodeOptions
+	opts.StrictEOF = true
+	cr := &countingReader{r: r}
+	ts, err := DecodeTimestampWithOptions(cr, t.Message, opts)
+	if err != nil {
+		return cr.n, err
+	}
+	*t = *ts
+	return cr.n, nil
+}
+
+// dumpFrame is a timestamp on the explicit DumpIndent stack
+type dumpFrame struct {
+	ts     *Timestamp
+	indent int
+	next   int
+}
+
+func (t *Timestamp) dumpHead(w io.Writer, indent int, cfg dumpConfig) {
 	if cfg.showMessage {
-		fmt.Fprintf(w, strings.Repeat(" ", indent))
+		fmt.Fprint(w, strings.Repeat(" ", indent))
 		fmt.Fprintf(w, "message %x\n", t.Message)
 	}
 	for _, att := range t.Attestations {
 		fmt.Fprint(w, strings.Repeat(" ", indent))
 		fmt.Fprintln(w, att)
 	}
+}
 
-	for _, tsLink := range t.ops {
-		fmt.Fprint(w, strings.Repeat(" ", indent))
+func (t *Timestamp) DumpIndent(w io.Writer, indent int, cfg dumpConfig) {
+	t.dumpHead(w, indent, cfg)
+	stack := []*dumpFrame{{ts: t, indent: indent}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		if f.next == len(f.ts.ops) {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		tsLink := f.ts.ops[f.next]
+		f.next += 1
+		fmt.Fprint(w, strings.Repeat(" ", f.indent))
 		fmt.Fprintln(w, tsLink.opCode)
-		// fmt.Fprint(w, strings.Repeat(" ", indent))
 		// if the timestamp is indeed tree-shaped, show it like that
-		if !cfg.showFlat || len(t.ops) > 1 {
-			indent += 1
+		if !cfg.showFlat || len(f.ts.ops) > 1 {
+			f.indent += 1
 		}
-		tsLink.timestamp.DumpIndent(w, indent, cfg)
+		tsLink.timestamp.dumpHead(w, f.indent, cfg)
+		stack = append(stack, &dumpFrame{
+			ts: tsLink.timestamp, indent: f.indent,
+		})
 	}
 }
 
@@ -114,49 +320,84 @@ func (t *Timestamp) Dump() string {
 	return t.DumpWithConfig(defaultDumpConfig)
 }
 
+// parseFrame is a timestamp on the explicit parser stack
+type parseFrame struct {
+	ts    *Timestamp
+	depth int
+	prev  *tsNode
+}
+
+// newParseFrame checks the resource limits for a new timestamp node and
+// returns a parseFrame for it.
+func newParseFrame(
+	ctx *deserializationContext, ts *Timestamp, depth int,
+) (*parseFrame, error) {
+	if max := ctx.opts.MaxDepth; max > 0 && depth >= max {
+		return nil, fmt.Errorf("recursion limit")
+	}
+	if err := ctx.addNode(); err != nil {
+		return nil, err
+	}
+	return &parseFrame{ts: ts, depth: depth}, nil
+}
+
+// parseTagOrAttestation parses the attestation or operation starting with
+// tag and adds it to the timestamp of f. For operations, the frame of the
+// resulting timestamp is returned and must be parsed next.
 func parseTagOrAttestation(
-	ts *Timestamp,
-	ctx *deserializationContext,
-	tag byte,
-	message []byte,
-	limit int,
-) error {
+	f *parseFrame, ctx *deserializationContext, tag byte,
+) (*parseFrame, error) {
+	ts := f.ts
 	if tag == 0x00 {
+		if err := ctx.addAttestation(); err != nil {
+			return nil, err
+		}
 		a, err := ParseAttestation(ctx)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		node := &tsNode{att: a}
+		if err := ctx.checkOrder(f.prev, node); err != nil {
+			return nil, err
 		}
+		f.prev = node
 		ts.Attestations = append(ts.Attestations, a)
+		return nil, nil
 	} else {
 		op, err := parseOp(ctx, tag)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		newMessage, err := op.apply(message)
-		if err != nil {
-			return err
+		node := &tsNode{op: op}
+		if err := ctx.checkOrder(f.prev, node); err != nil {
+			return nil, err
 		}
-		nextTs := &Timestamp{Message: newMessage}
-		err = parse(nextTs, ctx, newMessage, limit-1)
+		f.prev = node
+		newMessage, err := op.apply(ts.Message)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if err := ctx.checkResultLength(newMessage); err != nil {
+			return nil, err
 		}
+		nextTs := &Timestamp{Message: newMessage}
 		ts.ops = append(ts.ops, tsLink{op, nextTs})
-
+		return newParseFrame(ctx, nextTs, f.depth+1)
 	}
-	return nil
 }
 
-func parse(
-	ts *Timestamp, ctx *deserializationContext, message []byte, limit int,
-) error {
-	if limit == 0 {
-		return fmt.Errorf("recursion limit")
+// parse reads the attestations and operations of ts and all downstream
+// timestamps. An explicit stack is used instead of recursion, so that the
+// depth of the timestamp is only limited by ctx.opts.MaxDepth.
+func parse(ts *Timestamp, ctx *deserializationContext) error {
+	root, err := newParseFrame(ctx, ts, 0)
+	if err != nil {
+		return err
 	}
-	var tag byte
-	var err error
-	for {
-		tag, err = ctx.readByte()
+	stack := []*parseFrame{root}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		tag, err := ctx.readByte()
 		if err != nil {
 			return err
 		}
@@ -165,23 +406,26 @@ func parse(
 			if err != nil {
 				return err
 			}
-			err := parseTagOrAttestation(ts, ctx, tag, message, limit)
-			if err != nil {
-				return err
-			}
 		} else {
-			break
+			// last attestation or operation of this timestamp
+			stack = stack[:len(stack)-1]
+		}
+		next, err := parseTagOrAttestation(f, ctx, tag)
+		if err != nil {
+			return err
+		}
+		if next != nil {
+			stack = append(stack, next)
 		}
 	}
-	return parseTagOrAttestation(ts, ctx, tag, message, limit)
+	return nil
 }
 
 func newTimestampFromContext(
 	ctx *deserializationContext, message []byte,
 ) (*Timestamp, error) {
-	recursionLimit := 1000
 	ts := &Timestamp{Message: message}
-	err := parse(ts, ctx, message, recursionLimit)
+	err := parse(ts, ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -189,5 +433,23 @@ func newTimestampFromContext(
 }
 
 func NewTimestampFromReader(r io.Reader, message []byte) (*Timestamp, error) {
-	return newTimestampFromContext(newDeserializationContext(r), message)
+	return DecodeTimestampWithOptions(r, message, DefaultDecodeOptions)
+}
+
+// DecodeTimestampWithOptions parses a timestamp for message from r, applying
+// the limits and checks of opts.
+func DecodeTimestampWithOptions(
+	r io.Reader, message []byte, opts DecodeOptions,
+) (*Timestamp, error) {
+	ctx := newDeserializationContextWithOptions(r, opts)
+	ts, err := newTimestampFromContext(ctx, message)
+	if err != nil {
+		return nil, ctx.decodeError(err)
+	}
+	if opts.StrictEOF && !ctx.assertEOF() {
+		return nil, ctx.decodeError(
+			fmt.Errorf("expected EOF after timestamp"),
+		)
+	}
+	return ts, nil
 }
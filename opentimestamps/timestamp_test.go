@@ -0,0 +1,277 @@
+package opentimestamps
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addOp applies op to the message of ts and links the result
+func addOp(ts *Timestamp, op opCode) *Timestamp {
+	msg, err := op.apply(ts.Message)
+	if err != nil {
+		panic(err)
+	}
+	next := &Timestamp{Message: msg}
+	ts.ops = append(ts.ops, tsLink{op, next})
+	return next
+}
+
+func newAppendOp(arg []byte) *binaryOp {
+	op := *opAppend
+	op.argument = arg
+	return &op
+}
+
+func newPrependOp(arg []byte) *binaryOp {
+	op := *opPrepend
+	op.argument = arg
+	return &op
+}
+
+// newMerkleTimestamp returns a timestamp with the given number of leaves,
+// each one ending in a merkle path of the given depth and a bitcoin
+// attestation, similar to what calendar servers produce.
+func newMerkleTimestamp(leaves, depth int) *Timestamp {
+	root := &Timestamp{Message: newTestDigest("merkle")}
+	for i := 0; i < leaves; i++ {
+		arg := make([]byte, 8)
+		binary.BigEndian.PutUint64(arg, uint64(i))
+		ts := addOp(addOp(root, newAppendOp(arg)), opSHA256)
+		for j := 0; j < depth; j++ {
+			sibling := newTestDigest(string(ts.Message))
+			if j%2 == 0 {
+				ts = addOp(ts, newAppendOp(sibling))
+			} else {
+				ts = addOp(ts, newPrependOp(sibling))
+			}
+			ts = addOp(ts, opSHA256)
+		}
+		att := newBitcoinAttestation()
+		att.Height = uint64(400000 + i)
+		ts.Attestations = append(ts.Attestations, att)
+	}
+	return root
+}
+
+func encodeTimestamp(t *Timestamp) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := t.encode(newSerializationContext(buf))
+	return buf.Bytes(), err
+}
+
+func TestEncodeMultipleAttestations(t *testing.T) {
+	ts := &Timestamp{Message: testMessage}
+	for h := uint64(1); h <= 3; h++ {
+		att := newBitcoinAttestation()
+		att.Height = h
+		ts.Attestations = append(ts.Attestations, att)
+	}
+	addOp(ts, opSHA256).Attestations = []Attestation{newBitcoinAttestation()}
+
+	encoded, err := encodeTimestamp(ts)
+	require.NoError(t, err)
+
+	decoded, err := NewTimestampFromReader(
+		bytes.NewBuffer(encoded), testMessage,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, ts.Dump(), decoded.Dump())
+}
+
+func TestDeepTimestamp(t *testing.T) {
+	const depth = 100000
+	in := sha256Chain(depth)
+
+	_, err := NewTimestampFromReader(bytes.NewReader(in), testMessage)
+	assert.Error(t, err)
+
+	opts := DefaultDecodeOptions
+	opts.MaxDepth = 0
+	ts, err := DecodeTimestampWithOptions(
+		bytes.NewReader(in), testMessage, opts,
+	)
+	require.NoError(t, err)
+
+	n := 0
+	ts.Walk(func(*Timestamp) { n += 1 })
+	assert.Equal(t, depth+1, n)
+
+	encoded, err := encodeTimestamp(ts)
+	require.NoError(t, err)
+	assert.Equal(t, in, encoded)
+
+	ts.DumpIndent(ioutil.Discard, 0, dumpConfig{showFlat: true})
+}
+
+func TestMerkleTimestampRoundTrip(t *testing.T) {
+	ts := newMerkleTimestamp(16, 8)
+	encoded, err := encodeTimestamp(ts)
+	require.NoError(t, err)
+
+	decoded, err := NewTimestampFromReader(
+		bytes.NewReader(encoded), ts.Message,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, ts.Dump(), decoded.Dump())
+
+	reencoded, err := encodeTimestamp(decoded)
+	require.NoError(t, err)
+	assert.Equal(t, encoded, reencoded)
+}
+
+var benchmarkShapes = []struct {
+	name          string
+	leaves, depth int
+}{
+	{"Merkle-64x16", 64, 16},
+	{"Merkle-512x20", 512, 20},
+	{"Chain-1x4096", 1, 4096},
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, shape := range benchmarkShapes {
+		ts := newMerkleTimestamp(shape.leaves, shape.depth)
+		encoded, err := encodeTimestamp(ts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		opts := DefaultDecodeOptions
+		opts.MaxDepth = 0
+		b.Run(shape.name, func(b *testing.B) {
+			b.SetBytes(int64(len(encoded)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := DecodeTimestampWithOptions(
+					bytes.NewReader(encoded), ts.Message, opts,
+				)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, shape := range benchmarkShapes {
+		ts := newMerkleTimestamp(shape.leaves, shape.depth)
+		encoded, err := encodeTimestamp(ts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(shape.name, func(b *testing.B) {
+			b.SetBytes(int64(len(encoded)))
+			b.ReportAllocs()
+			buf := &bytes.Buffer{}
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				if err := ts.encode(newSerializationContext(buf)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	for _, shape := range benchmarkShapes {
+		ts := newMerkleTimestamp(shape.leaves, shape.depth)
+		b.Run(shape.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ts.Walk(func(*Timestamp) {})
+			}
+		})
+	}
+}
+
+func BenchmarkDump(b *testing.B) {
+	for _, shape := range benchmarkShapes {
+		ts := newMerkleTimestamp(shape.leaves, shape.depth)
+		b.Run(shape.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ts.DumpIndent(ioutil.Discard, 0, defaultDumpConfig)
+			}
+		})
+	}
+}
+
+func TestTimestampBinaryMarshaler(t *testing.T) {
+	ts := newMerkleTimestamp(4, 4)
+	data, err := ts.MarshalBinary()
+	require.NoError(t, err)
+
+	assert.Error(t, (&Timestamp{}).UnmarshalBinary(data))
+
+	decoded := &Timestamp{Message: ts.Message}
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, ts.Dump(), decoded.Dump())
+
+	buf := &bytes.Buffer{}
+	n, err := decoded.WriteTo(buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, data, buf.Bytes())
+
+	decoded = &Timestamp{Message: ts.Message}
+	n, err = decoded.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, ts.Dump(), decoded.Dump())
+}
+
+func TestTimestampEqual(t *testing.T) {
+	a := newMerkleTimestamp(4, 4)
+	b := newMerkleTimestamp(4, 4)
+	assert.True(t, a.Equal(b))
+	assert.True(t, a.Equal(a))
+
+	b.ops[1].timestamp.ops[0].timestamp.Attestations = []Attestation{
+		newPendingAttestation(),
+	}
+	assert.False(t, a.Equal(b))
+
+	c := newMerkleTimestamp(4, 4)
+	c.ops[3].opCode = newAppendOp([]byte("other"))
+	assert.False(t, a.Equal(c))
+
+	assert.False(t, a.Equal(newMerkleTimestamp(3, 4)))
+	assert.False(t, a.Equal(nil))
+}
+
+func TestWalkPath(t *testing.T) {
+	root := newMerkleTimestamp(3, 2)
+	var visited []*Timestamp
+	root.Walk(func(ts *Timestamp) {
+		visited = append(visited, ts)
+	})
+
+	i := 0
+	root.WalkPath(func(ts *Timestamp, path []*Timestamp) {
+		require.True(t, ts == visited[i])
+		i += 1
+		if ts == root {
+			assert.Equal(t, 0, len(path))
+			return
+		}
+		require.True(t, len(path) > 0)
+		assert.True(t, path[0] == root)
+		parent := path[len(path)-1]
+		found := false
+		for _, l := range parent.ops {
+			found = found || l.timestamp == ts
+		}
+		assert.True(t, found)
+		if len(ts.Attestations) > 0 {
+			// append, sha256 and two merkle steps of two ops each
+			assert.Equal(t, 6, len(path))
+		}
+	})
+	assert.Equal(t, len(visited), i)
+}
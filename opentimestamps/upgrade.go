@@ -0,0 +1,185 @@
+package opentimestamps
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+const (
+	// defaultUpgradeWorkers is the number of concurrent calendar requests
+	// if UpgradeOptions.Workers is not set.
+	defaultUpgradeWorkers = 16
+	// defaultUpgradePerCalendar is the number of concurrent requests to a
+	// single calendar if UpgradeOptions.MaxPerCalendar is not set.
+	defaultUpgradePerCalendar = 4
+)
+
+// UpgradeOptions configure UpgradeTimestamps.
+type UpgradeOptions struct {
+	// Workers is the total number of concurrent calendar requests.
+	Workers int
+	// MaxPerCalendar is the number of concurrent requests to one calendar.
+	MaxPerCalendar int
+	// NewCalendar returns the calendar of a pending attestation URI. It
+	// defaults to NewRemoteCalendar.
+	NewCalendar func(uri string) (*RemoteCalendar, error)
+}
+
+// An UpgradeResult is the outcome of upgrading a single timestamp.
+type UpgradeResult struct {
+	// Pending is the number of pending timestamps found.
+	Pending int
+	// Upgraded is the number of pending timestamps the calendars returned
+	// a timestamp for, which was merged.
+	Upgraded int
+	// Errors are the failed requests for the remaining pending timestamps.
+	Errors []error
+}
+
+// upgradeKey is a calendar request shared by all pending timestamps with
+// the same calendar and commitment
+type upgradeKey struct {
+	uri        string
+	commitment string
+}
+
+// upgradeRequest is a calendar request and its outcome
+type upgradeRequest struct {
+	key     upgradeKey
+	pending []int
+	ts      *Timestamp
+	err     error
+}
+
+// UpgradeTimestamps upgrades the pending attestations of many timestamps.
+// Pending timestamps with the same calendar and commitment are requested
+// only once, and the requests are made concurrently. The returned
+// timestamps are merged into each pending timestamp. The results are in
+// the same order as the timestamps.
+//
+// The timestamps are modified in place, and must not be used concurrently.
+func UpgradeTimestamps(
+	timestamps []*Timestamp, opts UpgradeOptions,
+) []UpgradeResult {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultUpgradeWorkers
+	}
+	perCalendar := opts.MaxPerCalendar
+	if perCalendar <= 0 {
+		perCalendar = defaultUpgradePerCalendar
+	}
+	newCalendar := opts.NewCalendar
+	if newCalendar == nil {
+		newCalendar = func(uri string) (*RemoteCalendar, error) {
+			return NewRemoteCalendar(uri)
+		}
+	}
+
+	results := make([]UpgradeResult, len(timestamps))
+	var pending []PendingTimestamp
+	var owners []int
+	var requests []*upgradeRequest
+	byKey := map[upgradeKey]*upgradeRequest{}
+	for i, ts := range timestamps {
+		for _, pts := range PendingTimestamps(ts) {
+			results[i].Pending += 1
+			key := upgradeKey{
+				pts.PendingAttestation.uri,
+				hex.EncodeToString(pts.Timestamp.Message),
+			}
+			req, ok := byKey[key]
+			if !ok {
+				req = &upgradeRequest{key: key}
+				byKey[key] = req
+				requests = append(requests, req)
+			}
+			req.pending = append(req.pending, len(pending))
+			pending = append(pending, pts)
+			owners = append(owners, i)
+		}
+	}
+
+	type calendar struct {
+		cal *RemoteCalendar
+		err error
+		sem chan struct{}
+	}
+	calendars := map[string]*calendar{}
+	for _, req := range requests {
+		if _, ok := calendars[req.key.uri]; ok {
+			continue
+		}
+		cal, err := newCalendar(req.key.uri)
+		calendars[req.key.uri] = &calendar{
+			cal, err, make(chan struct{}, perCalendar),
+		}
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, req := range requests {
+		c := calendars[req.key.uri]
+		if c.err != nil {
+			req.err = c.err
+			continue
+		}
+		wg.Add(1)
+		go func(req *upgradeRequest, c *calendar) {
+			defer wg.Done()
+			c.sem <- struct{}{}
+			sem <- struct{}{}
+			defer func() { <-sem; <-c.sem }()
+			commitment := pending[req.pending[0]].Timestamp.Message
+			req.ts, req.err = c.cal.GetTimestamp(commitment)
+		}(req, c)
+	}
+	wg.Wait()
+
+	for _, req := range requests {
+		for n, p := range req.pending {
+			res := &results[owners[p]]
+			err := req.err
+			if err == nil {
+				upgraded := req.ts
+				// each pending timestamp gets its own copy so proofs don't
+				// share nodes
+				if n < len(req.pending)-1 {
+					upgraded = upgraded.copy()
+				}
+				err = pending[p].Timestamp.Merge(upgraded)
+			}
+			if err != nil {
+				res.Errors = append(res.Errors, fmt.Errorf(
+					"%s: %v", req.key.uri, err,
+				))
+				continue
+			}
+			res.Upgraded += 1
+		}
+	}
+	return results
+}
+
+// copy returns a deep copy of the timestamp. Operations and attestations
+// are immutable and shared.
+func (t *Timestamp) copy() *Timestamp {
+	type pair struct{ dst, src *Timestamp }
+	root := &Timestamp{}
+	stack := []pair{{root, t}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		p.dst.Message = append([]byte(nil), p.src.Message...)
+		p.dst.Attestations = append(
+			[]Attestation(nil), p.src.Attestations...,
+		)
+		for _, link := range p.src.ops {
+			next := &Timestamp{}
+			p.dst.ops = append(p.dst.ops, tsLink{link.opCode, next})
+			stack = append(stack, pair{next, link.timestamp})
+		}
+	}
+	return root
+}
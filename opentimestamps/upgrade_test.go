@@ -0,0 +1,213 @@
+package opentimestamps
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCalendar answers timestamp requests with an append, sha256 and a
+// bitcoin attestation, counting requests per commitment.
+type fakeCalendar struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	requests    map[string]int
+	inFlight    int
+	maxInFlight int
+}
+
+func newFakeCalendar(t *testing.T) *fakeCalendar {
+	c := &fakeCalendar{requests: map[string]int{}}
+	c.Server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			commitment := strings.TrimPrefix(r.URL.Path, "/timestamp/")
+			c.mu.Lock()
+			c.requests[commitment] += 1
+			c.inFlight += 1
+			if c.inFlight > c.maxInFlight {
+				c.maxInFlight = c.inFlight
+			}
+			c.mu.Unlock()
+			defer func() {
+				c.mu.Lock()
+				c.inFlight -= 1
+				c.mu.Unlock()
+			}()
+			time.Sleep(5 * time.Millisecond)
+
+			message, err := hex.DecodeString(commitment)
+			require.NoError(t, err)
+			ts := &Timestamp{Message: message}
+			att := newBitcoinAttestation()
+			att.Height = 500000
+			leaf := addOp(addOp(ts, newAppendOp([]byte(c.URL))), opSHA256)
+			leaf.Attestations = append(leaf.Attestations, att)
+			data, err := encodeTimestamp(ts)
+			require.NoError(t, err)
+			w.Header().Set("Content-Type", calendarContentType)
+			w.Write(data)
+		},
+	))
+	return c
+}
+
+func newPendingAttestationURI(uri string) *pendingAttestation {
+	att := newPendingAttestation()
+	att.uri = uri
+	return att
+}
+
+// newBatchTimestamps returns timestamps for leaves merkle-hashed in pairs,
+// so two timestamps share each commitment, with pending attestations for
+// the given calendars.
+func newBatchTimestamps(leaves int, calendars ...string) []*Timestamp {
+	var timestamps []*Timestamp
+	for i := 0; i < leaves; i += 2 {
+		a := &Timestamp{Message: newTestDigest(string(rune('a' + i)))}
+		b := &Timestamp{Message: newTestDigest(string(rune('a' + i + 1)))}
+		commitA := addOp(addOp(a, newAppendOp(b.Message)), opSHA256)
+		commitB := addOp(addOp(b, newPrependOp(a.Message)), opSHA256)
+		for _, uri := range calendars {
+			commitA.Attestations = append(
+				commitA.Attestations, newPendingAttestationURI(uri),
+			)
+			commitB.Attestations = append(
+				commitB.Attestations, newPendingAttestationURI(uri),
+			)
+		}
+		timestamps = append(timestamps, a, b)
+	}
+	return timestamps
+}
+
+func TestTimestampMerge(t *testing.T) {
+	a := newMerkleTimestamp(4, 2)
+	b := newMerkleTimestamp(6, 2)
+	require.NoError(t, a.Merge(b))
+	assert.True(t, a.Equal(newMerkleTimestamp(6, 2)))
+
+	// merging again changes nothing
+	require.NoError(t, a.Merge(newMerkleTimestamp(6, 2)))
+	assert.True(t, a.Equal(b))
+
+	c := newMerkleTimestamp(2, 2)
+	c.ops[0].timestamp.ops[0].timestamp.Attestations = []Attestation{
+		newPendingAttestationURI("https://calendar.example.org"),
+	}
+	require.NoError(t, a.Merge(c))
+	assert.Equal(t, 1, len(PendingTimestamps(a)))
+	assert.Equal(t, 6, len(a.ops))
+
+	assert.Error(t, a.Merge(&Timestamp{Message: []byte("other")}))
+
+	// the merged timestamp is written in canonical order
+	d := &Timestamp{Message: newTestDigest("canonical")}
+	e := &Timestamp{Message: d.Message}
+	addOp(d, newAppendOp([]byte("b"))).Attestations = []Attestation{
+		newPendingAttestationURI("https://b.example.org"),
+	}
+	addOp(e, newAppendOp([]byte("a"))).Attestations = []Attestation{
+		newPendingAttestationURI("https://b.example.org"),
+	}
+	d.Attestations = []Attestation{
+		newPendingAttestationURI("https://b.example.org"),
+	}
+	e.Attestations = []Attestation{
+		newPendingAttestationURI("https://a.example.org"),
+	}
+	require.NoError(t, d.Merge(e))
+	data, err := d.MarshalBinary()
+	require.NoError(t, err)
+	decoded, err := DecodeTimestampWithOptions(
+		bytes.NewReader(data), d.Message, StrictDecodeOptions,
+	)
+	require.NoError(t, err)
+	uri, _ := PendingURI(decoded.Attestations[0])
+	assert.Equal(t, "https://a.example.org", uri)
+	assert.Equal(t, []byte("a"), opArgument(decoded.ops[0].opCode))
+}
+
+func TestTimestampCopy(t *testing.T) {
+	a := newMerkleTimestamp(3, 2)
+	b := a.copy()
+	assert.True(t, a.Equal(b))
+	b.ops[0].timestamp.Attestations = []Attestation{newPendingAttestation()}
+	assert.False(t, a.Equal(b))
+}
+
+func TestUpgradeTimestamps(t *testing.T) {
+	calA := newFakeCalendar(t)
+	defer calA.Close()
+	calB := newFakeCalendar(t)
+	defer calB.Close()
+	failing := httptest.NewServer(http.NotFoundHandler())
+	defer failing.Close()
+
+	timestamps := newBatchTimestamps(8, calA.URL, calB.URL)
+	timestamps = append(
+		timestamps, newBatchTimestamps(2, calA.URL, failing.URL)...,
+	)
+	results := UpgradeTimestamps(timestamps, UpgradeOptions{
+		MaxPerCalendar: 1,
+	})
+	require.Equal(t, 10, len(results))
+	for _, res := range results[:8] {
+		assert.Equal(t, UpgradeResult{Pending: 2, Upgraded: 2}, res)
+	}
+	for _, res := range results[8:] {
+		assert.Equal(t, 2, res.Pending)
+		assert.Equal(t, 1, res.Upgraded)
+		require.Equal(t, 1, len(res.Errors))
+		assert.Contains(t, res.Errors[0].Error(), failing.URL)
+	}
+
+	// each commitment is requested once per calendar, one at a time; the
+	// last batch repeats the first commitment
+	assert.Equal(t, 4, len(calA.requests))
+	assert.Equal(t, 4, len(calB.requests))
+	for _, cal := range []*fakeCalendar{calA, calB} {
+		for _, n := range cal.requests {
+			assert.Equal(t, 1, n)
+		}
+		assert.Equal(t, 1, cal.maxInFlight)
+	}
+
+	// the upgraded timestamps have an attestation from each calendar, and
+	// don't share any nodes
+	seen := map[*Timestamp]bool{}
+	for _, ts := range timestamps[:8] {
+		attested := 0
+		ts.Walk(func(ts *Timestamp) {
+			assert.False(t, seen[ts])
+			seen[ts] = true
+			for _, att := range ts.Attestations {
+				if _, ok := att.(*BitcoinAttestation); ok {
+					attested += 1
+				}
+			}
+		})
+		assert.Equal(t, 2, attested)
+	}
+
+	// merged attestations and operations are written in canonical order
+	for _, ts := range timestamps {
+		data, err := ts.MarshalBinary()
+		require.NoError(t, err)
+		decoded, err := DecodeTimestampWithOptions(
+			bytes.NewReader(data), ts.Message, StrictDecodeOptions,
+		)
+		require.NoError(t, err)
+		assert.Equal(
+			t, len(PendingTimestamps(ts)), len(PendingTimestamps(decoded)),
+		)
+	}
+}